@@ -0,0 +1,283 @@
+package queryplanner
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/arquivei/foundationkit/errors"
+)
+
+// ArgumentType is the type of the value of a field argument.
+type ArgumentType int
+
+const (
+	// StringArgument values are passed as they are requested.
+	StringArgument ArgumentType = iota
+	// IntArgument values are parsed as int.
+	IntArgument
+	// FloatArgument values are parsed as float64.
+	FloatArgument
+	// BoolArgument values are parsed as bool, e.g. true or false.
+	BoolArgument
+)
+
+func (t ArgumentType) String() string {
+	switch t {
+	case StringArgument:
+		return "string"
+	case IntArgument:
+		return "int"
+	case FloatArgument:
+		return "float"
+	case BoolArgument:
+		return "bool"
+	}
+	return fmt.Sprintf("ArgumentType(%d)", int(t))
+}
+
+// FieldArgument declares an argument accepted by a field. See
+// Field.Arguments.
+type FieldArgument struct {
+	Name string
+	Type ArgumentType
+}
+
+// FieldArguments are the arguments a field was requested with, by name.
+// Their values are string, int, float64 or bool, according to the
+// ArgumentType of their declaration.
+type FieldArguments map[string]interface{}
+
+// InvalidArgument is an argument of a requested field that is not accepted.
+type InvalidArgument struct {
+	Field FieldName
+	// Argument is the name of the argument. It is empty if the arguments
+	// could not be parsed.
+	Argument string
+	Reason   string
+}
+
+// ErrInvalidArguments is returned by QueryPlanner.NewPlanE, and by
+// Plan.Execute if the plan was created by NewPlan, when some requested
+// fields have invalid arguments. It matches any ErrInvalidArguments with
+// errors.Is.
+type ErrInvalidArguments struct {
+	Arguments []InvalidArgument
+}
+
+func (e *ErrInvalidArguments) Error() string {
+	arguments := make([]string, 0, len(e.Arguments))
+	for _, argument := range e.Arguments {
+		if argument.Argument == "" {
+			arguments = append(arguments, fmt.Sprintf("%s: %s", argument.Field, argument.Reason))
+			continue
+		}
+		arguments = append(arguments, fmt.Sprintf("%s(%s): %s", argument.Field, argument.Argument, argument.Reason))
+	}
+	return "invalid arguments: " + strings.Join(arguments, ", ")
+}
+
+// Is tells if @target is an ErrInvalidArguments.
+func (e *ErrInvalidArguments) Is(target error) bool {
+	_, ok := target.(*ErrInvalidArguments)
+	return ok
+}
+
+// requestedFieldArguments are the arguments of the requested fields before
+// they are validated, along with the fields whose arguments could not be
+// parsed.
+type requestedFieldArguments struct {
+	arguments map[FieldName]map[string]string
+	invalid   []InvalidArgument
+}
+
+// parseRequestedFields removes the arguments from @requestedFields, e.g.
+// Name(format=upper) becomes Name, and returns them.
+func parseRequestedFields(requestedFields []string) ([]string, requestedFieldArguments) {
+	names := make([]string, 0, len(requestedFields))
+	parsed := requestedFieldArguments{arguments: make(map[FieldName]map[string]string)}
+	for _, requestedField := range requestedFields {
+		name, arguments, malformed := parseRequestedField(requestedField)
+		names = append(names, string(name))
+		switch {
+		case malformed != "":
+			parsed.invalid = append(parsed.invalid, InvalidArgument{Field: FieldName(requestedField), Reason: malformed})
+		case arguments == nil:
+		case parsed.arguments[name] != nil && !isSameArguments(parsed.arguments[name], arguments):
+			parsed.invalid = append(parsed.invalid, InvalidArgument{Field: name, Reason: "requested with different arguments"})
+		default:
+			parsed.arguments[name] = arguments
+		}
+	}
+	return names, parsed
+}
+
+// parseRequestedField splits @requestedField into its name and its
+// arguments, if any. If the arguments are malformed, the reason is returned.
+func parseRequestedField(requestedField string) (name FieldName, arguments map[string]string, malformed string) {
+	start := strings.IndexByte(requestedField, '(')
+	if start < 0 {
+		return FieldName(requestedField), nil, ""
+	}
+	name = FieldName(strings.TrimSpace(requestedField[:start]))
+	if !strings.HasSuffix(requestedField, ")") {
+		return name, nil, "missing closing parenthesis"
+	}
+
+	body := strings.TrimSpace(requestedField[start+1 : len(requestedField)-1])
+	if body == "" {
+		return name, nil, ""
+	}
+	arguments = make(map[string]string)
+	for _, argument := range strings.Split(body, ",") {
+		key, value, found := strings.Cut(argument, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !found || key == "" {
+			return name, nil, fmt.Sprintf("malformed argument %q", strings.TrimSpace(argument))
+		}
+		if _, isDuplicated := arguments[key]; isDuplicated {
+			return name, nil, fmt.Sprintf("duplicated argument %q", key)
+		}
+		arguments[key] = value
+	}
+	return name, arguments, ""
+}
+
+// checkArguments validates the requested arguments against the declaration
+// of the activated fields and stores them in the plan. Nested fields
+// provided by a child planner keep their arguments to forward them to the
+// child plan, which validates them.
+func (p *plan) checkArguments(requested requestedFieldArguments, fieldToProviderMap fieldProviderByName) {
+	const op = errors.Op("plan.checkArguments")
+
+	invalid := requested.invalid
+	for _, name := range getSortedArgumentFields(requested.arguments) {
+		owner := p.resolveField(name)
+		if owner != name && fieldToProviderMap.HasChildren(owner) {
+			p.fieldArguments[name] = stringArguments(requested.arguments[name])
+			continue
+		}
+
+		// The fields of disabled providers are validated as well.
+		var declared []FieldArgument
+		if alternatives := fieldToProviderMap.GetAlternativesByName(name); owner == name && len(alternatives) > 0 {
+			declared = alternatives[0].field.Arguments
+			if provider, ok := p.fieldProviders[name]; ok {
+				field, _ := getField(provider, name)
+				declared = field.Arguments
+			}
+		}
+		arguments, invalidArguments := parseArguments(name, requested.arguments[name], declared)
+		invalid = append(invalid, invalidArguments...)
+		p.fieldArguments[name] = arguments
+	}
+
+	if len(invalid) > 0 && p.err == nil {
+		p.err = errors.E(op, &ErrInvalidArguments{Arguments: invalid})
+	}
+}
+
+// parseArguments converts the @arguments of @field to the types of their
+// @declared arguments.
+func parseArguments(field FieldName, arguments map[string]string, declared []FieldArgument) (FieldArguments, []InvalidArgument) {
+	types := make(map[string]ArgumentType, len(declared))
+	for _, argument := range declared {
+		types[argument.Name] = argument.Type
+	}
+
+	parsed := make(FieldArguments, len(arguments))
+	var invalid []InvalidArgument
+	for _, name := range getSortedKeys(arguments) {
+		argumentType, ok := types[name]
+		if !ok {
+			invalid = append(invalid, InvalidArgument{Field: field, Argument: name, Reason: "unknown argument"})
+			continue
+		}
+		value, err := parseArgumentValue(arguments[name], argumentType)
+		if err != nil {
+			invalid = append(invalid, InvalidArgument{
+				Field:    field,
+				Argument: name,
+				Reason:   fmt.Sprintf("%q is not a valid %s", arguments[name], argumentType),
+			})
+			continue
+		}
+		parsed[name] = value
+	}
+	return parsed, invalid
+}
+
+func parseArgumentValue(value string, argumentType ArgumentType) (interface{}, error) {
+	switch argumentType {
+	case IntArgument:
+		return strconv.Atoi(value)
+	case FloatArgument:
+		return strconv.ParseFloat(value, 64)
+	case BoolArgument:
+		return strconv.ParseBool(value)
+	}
+	return value, nil
+}
+
+// formatRequestedField returns @field with its @arguments, in the format
+// they are requested.
+func formatRequestedField(field string, arguments FieldArguments) string {
+	if len(arguments) == 0 {
+		return field
+	}
+	return field + "(" + formatArguments(arguments) + ")"
+}
+
+// formatArguments returns @arguments sorted by name, e.g. a=1,b=2.
+func formatArguments(arguments FieldArguments) string {
+	names := make([]string, 0, len(arguments))
+	for name := range arguments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	formatted := make([]string, 0, len(names))
+	for _, name := range names {
+		formatted = append(formatted, fmt.Sprintf("%s=%v", name, arguments[name]))
+	}
+	return strings.Join(formatted, ",")
+}
+
+func stringArguments(arguments map[string]string) FieldArguments {
+	converted := make(FieldArguments, len(arguments))
+	for name, value := range arguments {
+		converted[name] = value
+	}
+	return converted
+}
+
+func isSameArguments(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if other, ok := b[name]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+func getSortedArgumentFields(arguments map[FieldName]map[string]string) []FieldName {
+	fields := make([]FieldName, 0, len(arguments))
+	for field := range arguments {
+		fields = append(fields, field)
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i] < fields[j] })
+	return fields
+}
+
+func getSortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
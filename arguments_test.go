@@ -0,0 +1,228 @@
+package queryplanner
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRequestedField(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		requestedField    string
+		expectedName      FieldName
+		expectedArguments map[string]string
+		expectedMalformed string
+	}{
+		{requestedField: "name", expectedName: "name"},
+		{requestedField: "name()", expectedName: "name"},
+		{requestedField: "name(format=upper)", expectedName: "name", expectedArguments: map[string]string{"format": "upper"}},
+		{
+			requestedField:    "balance( currency = BRL, precision=2 )",
+			expectedName:      "balance",
+			expectedArguments: map[string]string{"currency": "BRL", "precision": "2"},
+		},
+		{requestedField: "name(format=upper", expectedName: "name", expectedMalformed: "missing closing parenthesis"},
+		{requestedField: "name(format)", expectedName: "name", expectedMalformed: `malformed argument "format"`},
+		{requestedField: "name(=upper)", expectedName: "name", expectedMalformed: `malformed argument "=upper"`},
+		{requestedField: "name(a=1,a=2)", expectedName: "name", expectedMalformed: `duplicated argument "a"`},
+	}
+	for _, test := range tests {
+		t.Run(test.requestedField, func(t *testing.T) {
+			t.Parallel()
+
+			name, arguments, malformed := parseRequestedField(test.requestedField)
+			assert.Equal(t, test.expectedName, name)
+			assert.Equal(t, test.expectedArguments, arguments)
+			assert.Equal(t, test.expectedMalformed, malformed)
+		})
+	}
+}
+
+//nolint:forcetypeassert
+func TestQueryPlanner_FieldArguments(t *testing.T) {
+	t.Parallel()
+
+	providers := []FieldProvider{
+		&fieldProviderMock{
+			name:      "name-provider",
+			dependsOn: []FieldName{"cpf"},
+			provides: []Field{
+				{
+					Name:      "name",
+					Arguments: []FieldArgument{{Name: "format", Type: StringArgument}, {Name: "max", Type: IntArgument}},
+					Fill: func(index int, ec ExecutionContext) error {
+						document := ec.Payload.Documents[index].(MapDocument)
+						name := "Maria da Silva"
+						if ec.Arguments()["format"] == "upper" {
+							name = strings.ToUpper(name)
+						}
+						if length, ok := ec.Arguments()["max"].(int); ok {
+							name = name[:length]
+						}
+						document["name"] = name
+						return nil
+					},
+				},
+			},
+		},
+		&fieldProviderMock{
+			name:      "balance-provider",
+			dependsOn: []FieldName{"name"},
+			provides: []Field{
+				{
+					Name: "balance",
+					Arguments: []FieldArgument{
+						{Name: "currency", Type: StringArgument},
+						{Name: "rate", Type: FloatArgument},
+						{Name: "rounded", Type: BoolArgument},
+					},
+					FillValue: func(index int, ec ExecutionContext) (interface{}, error) {
+						return ec.Arguments(), nil
+					},
+				},
+			},
+		},
+	}
+	indexProvider := &indexProviderMock{
+		provides: []Index{{Name: "cpf"}},
+		execute: func(*indexProviderMock, context.Context, Request, []string) (*Payload, error) {
+			return &Payload{Documents: []Document{MapDocument{"cpf": "1"}}}, nil
+		},
+	}
+	planner, err := NewQueryPlannerWithOptions(indexProvider, providers, WithMapDocuments())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name               string
+		request            []string
+		expectedDocuments  []Document
+		expectedProjection []map[string]interface{}
+	}{
+		{
+			name:               "without arguments",
+			request:            []string{"name"},
+			expectedDocuments:  []Document{MapDocument{"name": "Maria da Silva"}},
+			expectedProjection: []map[string]interface{}{{"name": "Maria da Silva"}},
+		},
+		{
+			name:               "with arguments",
+			request:            []string{"name(format=upper, max=5)", "name(max=5,format=upper)"},
+			expectedDocuments:  []Document{MapDocument{"name": "MARIA"}},
+			expectedProjection: []map[string]interface{}{{"name": "MARIA"}},
+		},
+		{
+			name:               "projected with arguments",
+			request:            []string{"name(format=upper)"},
+			expectedDocuments:  []Document{MapDocument{"name": "MARIA DA SILVA"}},
+			expectedProjection: []map[string]interface{}{{"name": "MARIA DA SILVA"}},
+		},
+		{
+			name:    "dependency without arguments",
+			request: []string{"balance(currency=BRL,rate=0.5,rounded=true)"},
+			expectedDocuments: []Document{
+				MapDocument{"balance": FieldArguments{"currency": "BRL", "rate": 0.5, "rounded": true}},
+			},
+			expectedProjection: []map[string]interface{}{
+				{"balance": FieldArguments{"currency": "BRL", "rate": 0.5, "rounded": true}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := planner.NewPlanE(&requestMock{test.request})
+			require.NoError(t, err)
+
+			payload, err := p.Execute(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedDocuments, payload.Documents)
+
+			projection, err := p.Project(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedProjection, projection.Documents)
+		})
+	}
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		t.Parallel()
+
+		request := &requestMock{[]string{
+			"name(format=upper,size=2)",
+			"name(format=lower)",
+			"balance(rate=high,rounded=yes)",
+			"cpf(mask=true)",
+			"balance(currency",
+		}}
+
+		_, err := planner.NewPlanE(request)
+		assert.EqualError(t, err, "queryplanner.NewPlanE: plan.checkArguments: invalid arguments: "+
+			"name: requested with different arguments, "+
+			"balance(currency: missing closing parenthesis, "+
+			`balance(rate): "high" is not a valid float, `+
+			`balance(rounded): "yes" is not a valid bool, `+
+			"cpf(mask): unknown argument, "+
+			"name(size): unknown argument")
+
+		var invalidArgumentsErr *ErrInvalidArguments
+		require.ErrorAs(t, err, &invalidArgumentsErr)
+		assert.Len(t, invalidArgumentsErr.Arguments, 6)
+		assert.ErrorIs(t, err, &ErrInvalidArguments{})
+
+		_, err = planner.NewPlan(request).Execute(context.Background())
+		assert.ErrorIs(t, err, &ErrInvalidArguments{})
+	})
+}
+
+func TestPlanExecution_EntityCache_FieldArguments(t *testing.T) {
+	t.Parallel()
+
+	provider := &fieldProviderMock{
+		name:      "name-provider",
+		dependsOn: []FieldName{"cpf"},
+		provides: []Field{{
+			Name:      "name",
+			Arguments: []FieldArgument{{Name: "format", Type: StringArgument}},
+			FillValue: func(_ int, ec ExecutionContext) (interface{}, error) {
+				if ec.Arguments()["format"] == "upper" {
+					return "MARIA", nil
+				}
+				return "maria", nil
+			},
+			Cache: &FieldCacheConfig{
+				Key: func(d Document) (string, bool) { return d.(MapDocument)["cpf"].(string), true },
+				TTL: time.Minute,
+			},
+		}},
+	}
+	indexProvider := &indexProviderMock{
+		provides: []Index{{Name: "cpf"}},
+		execute: func(*indexProviderMock, context.Context, Request, []string) (*Payload, error) {
+			return &Payload{Documents: []Document{MapDocument{"cpf": "1"}}}, nil
+		},
+	}
+	cache := NewEntityCache(NewMemoryCacheBackend(10))
+	planner, err := NewQueryPlannerWithOptions(indexProvider, []FieldProvider{provider}, WithMapDocuments(), WithEntityCache(cache))
+	require.NoError(t, err)
+
+	for _, test := range []struct {
+		request      string
+		expectedName string
+	}{
+		{request: "name(format=upper)", expectedName: "MARIA"},
+		{request: "name(format=lower)", expectedName: "maria"},
+		{request: "name(format=upper)", expectedName: "MARIA"},
+		{request: "name", expectedName: "maria"},
+	} {
+		payload, err := planner.NewPlan(&requestMock{[]string{test.request}}).Execute(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []Document{MapDocument{"name": test.expectedName}}, payload.Documents, test.request)
+	}
+	assert.Equal(t, EntityCacheStats{Hits: 1, Misses: 3}, cache.Stats())
+}
@@ -31,7 +31,7 @@ func checkCycle(fieldToProviderMap fieldProviderByName) error {
 		if cycle != nil {
 			return errors.E(
 				op,
-				"cycle found in field dependency",
+				&ErrCycle{Path: reverseFieldNames(cycle)},
 				errors.KV("cycle", getCycleString(cycle)),
 			)
 		}
@@ -52,25 +52,44 @@ func getCycleFromNode(
 		visitedNodes[node] = cycleDetectionDone
 	}()
 
-	provider, providerExists := fieldToProviderMap.GetByName(node)
-	if !providerExists {
-		return nil
-	}
-
-	for _, child := range provider.DependsOn() {
-		if visitedNodes[child] == cycleDetectionDone {
-			continue
-		}
-		cycle := getCycleFromNode(child, visitedNodes, fieldToProviderMap)
-		if cycle == nil {
-			continue
+	for _, alternative := range fieldToProviderMap.GetAlternativesByName(node) {
+		for _, child := range getAllFieldDependencies(alternative.provider, alternative.field) {
+			child = fieldToProviderMap.Resolve(child)
+			if visitedNodes[child] == cycleDetectionDone {
+				continue
+			}
+			cycle := getCycleFromNode(child, visitedNodes, fieldToProviderMap)
+			if cycle == nil {
+				continue
+			}
+			if isCycleClosed(cycle) {
+				// @node only leads to the cycle
+				return cycle
+			}
+			return append(cycle, node)
 		}
-		return append(cycle, node)
 	}
 
 	return nil
 }
 
+// isCycleClosed tells if the @cycle being built while unwinding the DFS
+// already ends with the node it starts with, so the nodes still in the
+// stack are not part of it.
+func isCycleClosed(cycle []FieldName) bool {
+	return len(cycle) > 1 && cycle[0] == cycle[len(cycle)-1]
+}
+
+// reverseFieldNames returns the @cycle built while unwinding the DFS in
+// dependency order.
+func reverseFieldNames(cycle []FieldName) []FieldName {
+	path := make([]FieldName, 0, len(cycle))
+	for i := len(cycle) - 1; i >= 0; i-- {
+		path = append(path, cycle[i])
+	}
+	return path
+}
+
 func getCycleString(cycle []FieldName) string {
 	cycleString := ""
 	for i := len(cycle) - 1; i >= 0; i-- {
@@ -79,15 +98,45 @@ func getCycleString(cycle []FieldName) string {
 	return cycleString
 }
 
-func checkMethodsFromFieldProvider(fieldProvider FieldProvider) error {
+// checkMethodsFromFieldProvider ensures that every field of @fieldProvider
+// can be filled and cleared. If the documents have an adapter, the methods
+// the fields do not set are derived from it.
+func checkMethodsFromFieldProvider(fieldProvider FieldProvider, config config) error {
 	const op = errors.Op("checkMethodsFromFieldProvider")
 	for _, field := range fieldProvider.Provides() {
-		if field.Fill == nil {
+		if field.Fill == nil && field.BatchFill == nil && field.FillValue == nil {
 			return errors.E(op, "there is no `fill' method for field", errors.KV("fieldName", field.Name))
 		}
+		if field.Fill != nil && field.BatchFill != nil {
+			return errors.E(op, "field has both `fill' and `batchFill' methods", errors.KV("fieldName", field.Name))
+		}
+		if field.FillValue != nil && (field.Fill != nil || field.BatchFill != nil) {
+			return errors.E(op, "field has both `fillValue' and `fill' or `batchFill' methods", errors.KV("fieldName", field.Name))
+		}
+		if config.documentAdapter != nil {
+			if err := config.documentAdapter.checkField(field.Name); err != nil {
+				return errors.E(op, err)
+			}
+		}
+		field = config.completeField(field)
+		if field.FillValue != nil && field.Set == nil {
+			return errors.E(op, "field filled by `fillValue' has no `set' method", errors.KV("fieldName", field.Name))
+		}
 		if field.Clear == nil {
 			return errors.E(op, "there is no `clear` method for field", errors.KV("fieldName", field.Name))
 		}
+		if field.Cache != nil {
+			err := checkFieldCacheConfig(field)
+			if err != nil {
+				return errors.E(op, err, errors.KV("fieldName", field.Name))
+			}
+		}
+		if field.Children != nil {
+			err := checkChildPlanner(field.Children)
+			if err != nil {
+				return errors.E(op, err, errors.KV("fieldName", field.Name))
+			}
+		}
 	}
 	return nil
 }
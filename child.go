@@ -0,0 +1,244 @@
+package queryplanner
+
+import (
+	"context"
+	stderrors "errors"
+	"sort"
+	"strings"
+
+	"github.com/arquivei/foundationkit/errors"
+)
+
+// ChildPlanner enriches the child documents of a field, e.g. the dependents
+// of a person, with a QueryPlanner of its own. See Field.Children.
+type ChildPlanner struct {
+	// Planner plans the enrichment of the children. Its IndexProvider
+	// receives a *ChildRequest and must return its Documents, which are
+	// enriched in place, so they must be pointers or maps. See
+	// NewChildIndexProvider.
+	//
+	// If the parent planner is in partial results mode, the failures of the
+	// children are recorded as failures of their parents. A child planner
+	// not in partial results mode fails the whole child plan on the first
+	// failure, which makes the requested child fields fail in all the
+	// parents, with their children possibly partially filled.
+	Planner QueryPlanner
+	// Get returns the children of a document.
+	Get func(Document) []Document
+}
+
+// ChildRequest is the Request of the plan of a ChildPlanner. It has the
+// children of all the documents of the parent payload, so the child plan is
+// executed once for all of them.
+type ChildRequest struct {
+	// Parent is the request of the parent plan.
+	Parent Request
+	// Fields are the requested child fields, that is, the requested or
+	// depended upon parent fields nested under the field, without its
+	// prefix, and with their arguments. E.g. Dependents.Name(format=upper)
+	// requests Name(format=upper).
+	Fields []string
+	// Documents are the children.
+	Documents []Document
+}
+
+// GetRequestedFields returns the requested child fields.
+func (r *ChildRequest) GetRequestedFields() []string {
+	return r.Fields
+}
+
+// NewChildIndexProvider returns an IndexProvider for a ChildPlanner. It
+// returns the Documents of the ChildRequest, whose @indexes are already set.
+func NewChildIndexProvider(indexes ...Index) IndexProvider {
+	return &childIndexProvider{indexes: indexes}
+}
+
+type childIndexProvider struct {
+	indexes []Index
+}
+
+func (i *childIndexProvider) Provides() []Index {
+	return i.indexes
+}
+
+func (i *childIndexProvider) Execute(_ context.Context, request Request, _ []string) (*Payload, error) {
+	const op = errors.Op("childIndexProvider.Execute")
+	childRequest, ok := request.(*ChildRequest)
+	if !ok {
+		return nil, errors.E(op, "request is not a child request")
+	}
+	return &Payload{Documents: childRequest.Documents}, nil
+}
+
+func checkChildPlanner(children *ChildPlanner) error {
+	const op = errors.Op("checkChildPlanner")
+	switch {
+	case children.Planner == nil:
+		return errors.E(op, "child planner has no planner")
+	case children.Get == nil:
+		return errors.E(op, "child planner has no `get` method")
+	}
+	return nil
+}
+
+// fillChildren executes the ChildPlanner of @field over the children of all
+// the documents of the payload. In partial results mode, the failures of
+// the children are recorded as failures of their parents. If the whole child
+// plan fails, e.g. because the child planner is not in partial results mode,
+// the requested child fields fail for all the parents with children.
+func (e *planExecution) fillChildren(ctx context.Context, field Field) error {
+	const op = errors.Op("planExecution.fillChildren")
+
+	childFields := e.plan.getChildFields(field.Name)
+	if len(childFields) == 0 {
+		return nil
+	}
+
+	var children []Document
+	var parents []int
+	for index, document := range e.data.Documents {
+		for _, child := range field.Children.Get(document) {
+			children = append(children, child)
+			parents = append(parents, index)
+		}
+	}
+	if len(children) == 0 {
+		return nil
+	}
+
+	request := &ChildRequest{Parent: e.plan.request, Fields: childFields, Documents: children}
+	childPlan, err := field.Children.Planner.NewPlanE(request)
+	if err != nil {
+		return errors.E(op, err, errors.KV("field", field.Name))
+	}
+	payload, err := childPlan.Execute(ctx)
+	if err != nil && e.plan.config.partialResults && ctx.Err() == nil {
+		e.recordChildPlanFailure(field.Name, childFields, parents, err)
+		return nil
+	}
+	if err != nil {
+		return errors.E(op, err, errors.KV("field", field.Name))
+	}
+
+	if len(payload.Errors) == 0 {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, childError := range payload.Errors {
+		fieldError := FieldError{
+			DocumentIndex: parents[childError.DocumentIndex],
+			Field:         getNestedFieldName(field.Name, childError.Field),
+			Err:           childError.Err,
+		}
+		if childError.SkippedBecause != "" {
+			fieldError.SkippedBecause = getNestedFieldName(field.Name, childError.SkippedBecause)
+		}
+		e.addFailure(fieldError)
+	}
+	return nil
+}
+
+// recordChildPlanFailure records the failure of the child plan of @field as
+// failures of its @childFields in each of the @parents.
+func (e *planExecution) recordChildPlanFailure(field FieldName, childFields []string, parents []int, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for position, parent := range parents {
+		if position > 0 && parents[position-1] == parent {
+			continue
+		}
+		for _, childField := range childFields {
+			name, _, _ := parseRequestedField(childField)
+			e.addFailure(FieldError{DocumentIndex: parent, Field: getNestedFieldName(field, name), Err: err})
+		}
+	}
+}
+
+// checkChildPlans validates the nested fields of the plan, and their
+// arguments, against the planners of the fields with children. The names in
+// the returned ErrUnknownFields and ErrInvalidArguments are nested under
+// their parent fields.
+func (p *plan) checkChildPlans() error {
+	const op = errors.Op("plan.checkChildPlans")
+
+	var unknownFields []UnknownField
+	var invalidArguments []InvalidArgument
+	for _, field := range p.getFieldsWithChildren() {
+		request := &ChildRequest{Parent: p.request, Fields: p.getChildFields(field.Name)}
+		_, err := field.Children.Planner.NewPlanE(request)
+		if err == nil {
+			continue
+		}
+
+		var unknownFieldsErr *ErrUnknownFields
+		var invalidArgumentsErr *ErrInvalidArguments
+		switch {
+		case stderrors.As(err, &unknownFieldsErr):
+			for _, unknownField := range unknownFieldsErr.Fields {
+				unknownField.Name = getNestedFieldName(field.Name, unknownField.Name)
+				if unknownField.Suggestion != "" {
+					unknownField.Suggestion = getNestedFieldName(field.Name, unknownField.Suggestion)
+				}
+				unknownFields = append(unknownFields, unknownField)
+			}
+		case stderrors.As(err, &invalidArgumentsErr):
+			for _, invalidArgument := range invalidArgumentsErr.Arguments {
+				invalidArgument.Field = getNestedFieldName(field.Name, invalidArgument.Field)
+				invalidArguments = append(invalidArguments, invalidArgument)
+			}
+		default:
+			return errors.E(op, err, errors.KV("field", field.Name))
+		}
+	}
+
+	if len(unknownFields) > 0 {
+		return errors.E(op, &ErrUnknownFields{Fields: unknownFields})
+	}
+	if len(invalidArguments) > 0 {
+		return errors.E(op, &ErrInvalidArguments{Arguments: invalidArguments})
+	}
+	return nil
+}
+
+// getFieldsWithChildren returns the activated fields with a ChildPlanner
+// that have nested fields in the plan, sorted by name.
+func (p *plan) getFieldsWithChildren() []Field {
+	owners := newFieldNameSet(0)
+	for _, owner := range p.fieldOwners {
+		owners.Add(owner)
+	}
+
+	fields := make([]Field, 0)
+	for _, name := range p.activationOrder {
+		provider, ok := p.fieldProviders[name]
+		if !ok || !owners.Exists(name) {
+			continue
+		}
+		if field, _ := getField(provider, name); field.Children != nil {
+			fields = append(fields, field)
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+	return fields
+}
+
+// getChildFields returns the activated fields nested under @field without
+// its prefix, sorted.
+func (p *plan) getChildFields(field FieldName) []string {
+	prefix := string(field) + fieldPathSeparator
+	childFields := make([]string, 0)
+	for nested, owner := range p.fieldOwners {
+		if owner == field && strings.HasPrefix(string(nested), prefix) {
+			childField := strings.TrimPrefix(string(nested), prefix)
+			childFields = append(childFields, formatRequestedField(childField, p.fieldArguments[nested]))
+		}
+	}
+	sort.Strings(childFields)
+	return childFields
+}
+
+func getNestedFieldName(parent FieldName, field FieldName) FieldName {
+	return parent + fieldPathSeparator + field
+}
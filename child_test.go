@@ -0,0 +1,367 @@
+package queryplanner
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type childDependent struct {
+	cpf  string
+	name string
+	age  int
+}
+
+type childPerson struct {
+	cpf        string
+	dependents []*childDependent
+	summary    string
+}
+
+func TestPlanExecution_ChildPlanner(t *testing.T) {
+	t.Parallel()
+
+	var childBatches atomic.Int32
+	childPlanner, err := NewQueryPlannerWithOptions(
+		NewChildIndexProvider(
+			Index{Name: "cpf", Clear: func(d Document) { d.(*childDependent).cpf = "" }},
+			Index{Name: "age", Clear: func(d Document) { d.(*childDependent).age = 0 }},
+		),
+		[]FieldProvider{&fieldProviderMock{
+			name:      "dependent-name-provider",
+			dependsOn: []FieldName{"cpf"},
+			provides: []Field{{
+				Name: "name",
+				Fill: func(index int, ec ExecutionContext) error {
+					if index == 0 {
+						childBatches.Add(1)
+					}
+					dependent := ec.Payload.Documents[index].(*childDependent)
+					dependent.name = "name-" + dependent.cpf
+					return nil
+				},
+				Clear: func(d Document) { d.(*childDependent).name = "" },
+			}},
+		}},
+	)
+	require.NoError(t, err)
+
+	providers := []FieldProvider{
+		&fieldProviderMock{
+			name:      "dependents-provider",
+			dependsOn: []FieldName{"cpf"},
+			provides: []Field{{
+				Name: "dependents",
+				Fill: func(index int, ec ExecutionContext) error {
+					person := ec.Payload.Documents[index].(*childPerson)
+					person.dependents = []*childDependent{{cpf: person.cpf + "1", age: 3}, {cpf: person.cpf + "2", age: 5}}
+					return nil
+				},
+				Clear: func(d Document) { d.(*childPerson).dependents = nil },
+				Children: &ChildPlanner{
+					Planner: childPlanner,
+					Get: func(d Document) []Document {
+						children := make([]Document, 0)
+						for _, dependent := range d.(*childPerson).dependents {
+							children = append(children, dependent)
+						}
+						return children
+					},
+				},
+			}},
+		},
+		&fieldProviderMock{
+			name:      "summary-provider",
+			dependsOn: []FieldName{"dependents.name"},
+			provides: []Field{{
+				Name: "summary",
+				Fill: func(index int, ec ExecutionContext) error {
+					person := ec.Payload.Documents[index].(*childPerson)
+					names := make([]string, 0, len(person.dependents))
+					for _, dependent := range person.dependents {
+						names = append(names, dependent.name)
+					}
+					person.summary = strings.Join(names, ",")
+					return nil
+				},
+				Clear: func(d Document) { d.(*childPerson).summary = "" },
+			}},
+		},
+	}
+	indexProvider := &indexProviderMock{
+		provides: []Index{{Name: "cpf", Clear: func(d Document) { d.(*childPerson).cpf = "" }}},
+		execute: func(*indexProviderMock, context.Context, Request, []string) (*Payload, error) {
+			return &Payload{Documents: []Document{&childPerson{cpf: "a"}, &childPerson{cpf: "b"}}}, nil
+		},
+	}
+	planner, err := NewQueryPlannerWithOptions(indexProvider, providers)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name              string
+		request           []string
+		expectedDocuments []Document
+		expectedBatches   int32
+	}{
+		{
+			name:    "nested field",
+			request: []string{"summary"},
+			expectedDocuments: []Document{
+				&childPerson{summary: "name-a1,name-a2"},
+				&childPerson{summary: "name-b1,name-b2"},
+			},
+			expectedBatches: 1,
+		},
+		{
+			name:    "requested nested field",
+			request: []string{"dependents.name"},
+			expectedDocuments: []Document{
+				&childPerson{dependents: []*childDependent{{name: "name-a1"}, {name: "name-a2"}}},
+				&childPerson{dependents: []*childDependent{{name: "name-b1"}, {name: "name-b2"}}},
+			},
+			expectedBatches: 1,
+		},
+		{
+			name:    "wildcard",
+			request: []string{"dependents.*"},
+			expectedDocuments: []Document{
+				&childPerson{dependents: []*childDependent{{cpf: "a1", name: "name-a1", age: 3}, {cpf: "a2", name: "name-a2", age: 5}}},
+				&childPerson{dependents: []*childDependent{{cpf: "b1", name: "name-b1", age: 3}, {cpf: "b2", name: "name-b2", age: 5}}},
+			},
+			expectedBatches: 1,
+		},
+		{
+			name:    "no nested field",
+			request: []string{"dependents"},
+			expectedDocuments: []Document{
+				&childPerson{dependents: []*childDependent{{cpf: "a1", age: 3}, {cpf: "a2", age: 5}}},
+				&childPerson{dependents: []*childDependent{{cpf: "b1", age: 3}, {cpf: "b2", age: 5}}},
+			},
+		},
+	}
+	for _, test := range tests {
+		// The subtests share the batch counter, so they do not run in parallel.
+		t.Run(test.name, func(t *testing.T) {
+			childBatches.Store(0)
+
+			payload, err := planner.NewPlan(&requestMock{test.request}).Execute(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedDocuments, payload.Documents)
+			assert.Equal(t, test.expectedBatches, childBatches.Load())
+		})
+	}
+
+	t.Run("field arguments", func(t *testing.T) {
+		p := planner.NewPlan(&requestMock{[]string{"dependents.name(format=upper)"}}).(plan)
+		assert.Equal(t, []string{"name(format=upper)"}, p.getChildFields("dependents"))
+
+		_, err := p.Execute(context.Background())
+		assert.ErrorContains(t, err, "invalid arguments: name(format): unknown argument")
+	})
+
+	for _, test := range []struct {
+		name          string
+		request       []string
+		expectedError string
+	}{
+		{
+			name:          "unknown nested field",
+			request:       []string{"dependents.nme"},
+			expectedError: "queryplanner.NewPlanE: plan.checkChildPlans: unknown fields: dependents.nme (did you mean dependents.name?)",
+		},
+		{
+			name:          "invalid nested arguments",
+			request:       []string{"dependents.name(x=1)"},
+			expectedError: "queryplanner.NewPlanE: plan.checkChildPlans: invalid arguments: dependents.name(x): unknown argument",
+		},
+		{
+			name:    "valid nested field",
+			request: []string{"dependents.name", "summary"},
+		},
+	} {
+		t.Run("NewPlanE "+test.name, func(t *testing.T) {
+			_, err := planner.NewPlanE(&requestMock{test.request})
+			if test.expectedError == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, test.expectedError)
+		})
+	}
+}
+
+func TestPlanExecution_ChildPlanner_PartialResults(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name              string
+		options           []Option
+		childOptions      []Option
+		request           []string
+		expectedDocuments []Document
+		expectedErrors    []FieldError
+		expectedError     string
+		// expectedChildPlanError is the error of the failed child plan,
+		// recorded in expectedErrors, where it is omitted.
+		expectedChildPlanError string
+	}{
+		{
+			name:         "requested nested field",
+			options:      []Option{WithPartialResults()},
+			childOptions: []Option{WithPartialResults()},
+			request:      []string{"dependents.name"},
+			expectedDocuments: []Document{
+				&childPerson{dependents: []*childDependent{{name: "name-a1"}, {name: "name-a2"}}},
+				&childPerson{dependents: []*childDependent{{name: "name-b1"}, {}}},
+			},
+			expectedErrors: []FieldError{
+				{DocumentIndex: 1, Field: "dependents.name", Err: errors.New("name not found")},
+			},
+		},
+		{
+			name:              "dependent field",
+			options:           []Option{WithPartialResults()},
+			childOptions:      []Option{WithPartialResults()},
+			request:           []string{"summary"},
+			expectedDocuments: []Document{&childPerson{summary: "name-a1,name-a2"}, &childPerson{}},
+			expectedErrors: []FieldError{
+				{DocumentIndex: 1, Field: "dependents.name", Err: errors.New("name not found")},
+				{DocumentIndex: 1, Field: "summary", SkippedBecause: "dependents.name"},
+			},
+		},
+		{
+			name:              "child planner without partial results",
+			options:           []Option{WithPartialResults()},
+			request:           []string{"summary"},
+			expectedDocuments: []Document{&childPerson{}, &childPerson{}},
+			expectedErrors: []FieldError{
+				{DocumentIndex: 0, Field: "dependents.name"},
+				{DocumentIndex: 0, Field: "summary", SkippedBecause: "dependents.name"},
+				{DocumentIndex: 1, Field: "dependents.name"},
+				{DocumentIndex: 1, Field: "summary", SkippedBecause: "dependents.name"},
+			},
+			expectedChildPlanError: "queryplanner.Plan.Execute: planExecution.start: planExecution.executeProvider: name not found",
+		},
+		{
+			name:    "without partial results",
+			request: []string{"dependents.name"},
+			expectedError: "queryplanner.Plan.Execute: planExecution.start: planExecution.executeProvider: planExecution.fillChildren: " +
+				"queryplanner.Plan.Execute: planExecution.start: planExecution.executeProvider: name not found [field=dependents]",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			childPlanner, err := NewQueryPlannerWithOptions(
+				NewChildIndexProvider(Index{Name: "cpf", Clear: func(d Document) { d.(*childDependent).cpf = "" }}),
+				[]FieldProvider{&fieldProviderMock{
+					name:      "dependent-name-provider",
+					dependsOn: []FieldName{"cpf"},
+					provides: []Field{{
+						Name: "name",
+						Fill: func(index int, ec ExecutionContext) error {
+							dependent := ec.Payload.Documents[index].(*childDependent)
+							if dependent.cpf == "b2" {
+								return errors.New("name not found")
+							}
+							dependent.name = "name-" + dependent.cpf
+							return nil
+						},
+						Clear: func(d Document) { d.(*childDependent).name = "" },
+					}},
+				}},
+				test.childOptions...,
+			)
+			require.NoError(t, err)
+
+			providers := []FieldProvider{
+				&fieldProviderMock{
+					name:      "dependents-provider",
+					dependsOn: []FieldName{"cpf"},
+					provides: []Field{{
+						Name: "dependents",
+						Fill: func(index int, ec ExecutionContext) error {
+							person := ec.Payload.Documents[index].(*childPerson)
+							person.dependents = []*childDependent{{cpf: person.cpf + "1"}, {cpf: person.cpf + "2"}}
+							return nil
+						},
+						Clear: func(d Document) { d.(*childPerson).dependents = nil },
+						Children: &ChildPlanner{
+							Planner: childPlanner,
+							Get: func(d Document) []Document {
+								children := make([]Document, 0)
+								for _, dependent := range d.(*childPerson).dependents {
+									children = append(children, dependent)
+								}
+								return children
+							},
+						},
+					}},
+				},
+				&fieldProviderMock{
+					name:      "summary-provider",
+					dependsOn: []FieldName{"dependents.name"},
+					provides: []Field{{
+						Name: "summary",
+						Fill: func(index int, ec ExecutionContext) error {
+							person := ec.Payload.Documents[index].(*childPerson)
+							names := make([]string, 0, len(person.dependents))
+							for _, dependent := range person.dependents {
+								names = append(names, dependent.name)
+							}
+							person.summary = strings.Join(names, ",")
+							return nil
+						},
+						Clear: func(d Document) { d.(*childPerson).summary = "" },
+					}},
+				},
+			}
+			indexProvider := &indexProviderMock{
+				provides: []Index{{Name: "cpf", Clear: func(d Document) { d.(*childPerson).cpf = "" }}},
+				execute: func(*indexProviderMock, context.Context, Request, []string) (*Payload, error) {
+					return &Payload{Documents: []Document{&childPerson{cpf: "a"}, &childPerson{cpf: "b"}}}, nil
+				},
+			}
+			planner, err := NewQueryPlannerWithOptions(indexProvider, providers, test.options...)
+			require.NoError(t, err)
+
+			payload, err := planner.NewPlan(&requestMock{test.request}).Execute(context.Background())
+			if test.expectedError != "" {
+				assert.EqualError(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			if test.expectedChildPlanError != "" {
+				for index := range payload.Errors {
+					if payload.Errors[index].Err != nil {
+						assert.EqualError(t, payload.Errors[index].Err, test.expectedChildPlanError)
+						payload.Errors[index].Err = nil
+					}
+				}
+			}
+			assert.Equal(t, test.expectedDocuments, payload.Documents)
+			assert.Equal(t, test.expectedErrors, payload.Errors)
+		})
+	}
+}
+
+func TestQueryPlanner_ChildPlannerValidation(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewQueryPlanner(
+		&indexProviderMock{provides: []Index{newNoopIndex("cpf")}},
+		&fieldProviderMock{name: "dependents-provider", provides: []Field{{
+			Name:     "dependents",
+			Fill:     func(int, ExecutionContext) error { return nil },
+			Clear:    func(Document) {},
+			Children: &ChildPlanner{Get: func(Document) []Document { return nil }},
+		}}},
+	)
+	assert.EqualError(t, err, "queryplanner.NewQueryPlanner: checkIfFieldProvidersAreDeclaredCorrectly: checkMethodsFromFieldProvider: checkChildPlanner: child planner has no planner [fieldName=dependents]")
+}
@@ -0,0 +1,124 @@
+package queryplanner
+
+import "math"
+
+// CostEstimatingFieldProvider is an optional interface a FieldProvider may
+// implement to estimate the cost of executing it for a Request, e.g. from
+// the number of documents. It is used to choose among the providers of a
+// field. See WithCostBasedSelection. Providers that do not implement it cost
+// 1.
+type CostEstimatingFieldProvider interface {
+	FieldProvider
+	Cost(Request) float64
+}
+
+// providerCost returns the cost of executing @provider for @request. A NaN
+// cost is taken as +Inf.
+func providerCost(provider FieldProvider, request Request) float64 {
+	if estimating, ok := provider.(CostEstimatingFieldProvider); ok {
+		if cost := estimating.Cost(request); !math.IsNaN(cost) {
+			return cost
+		}
+		return math.Inf(1)
+	}
+	return 1
+}
+
+// deferredActivation is the activation of a field with more than one
+// provider, which is postponed until the providers that must be executed
+// anyway are known.
+type deferredActivation struct {
+	field  FieldName
+	parent FieldName
+}
+
+// deferActivation postpones the activation of @fieldName if the provider
+// filling it must be selected by cost and it has not been selected yet.
+func (p *plan) deferActivation(fieldName FieldName, parent FieldName, fieldToProviderMap fieldProviderByName) bool {
+	if !p.config.costBasedSelection || p.processedFields.Exists(fieldName) {
+		return false
+	}
+	if _, isSelected := p.selectedProviders[fieldName]; isSelected {
+		return false
+	}
+	if len(p.getEnabledAlternatives(fieldName, fieldToProviderMap)) < 2 {
+		return false
+	}
+	p.deferredActivations = append(p.deferredActivations, deferredActivation{field: fieldName, parent: parent})
+	return true
+}
+
+// activateDeferredFields selects the providers of the deferred fields, one
+// field at a time, and activates them. Activating a field may defer others.
+func (p *plan) activateDeferredFields(fieldToProviderMap fieldProviderByName) {
+	for len(p.deferredActivations) > 0 {
+		activation := p.deferredActivations[0]
+		p.deferredActivations = p.deferredActivations[1:]
+
+		if _, isSelected := p.selectedProviders[activation.field]; !isSelected && !p.processedFields.Exists(activation.field) {
+			p.selectedProviders[activation.field] = p.selectCheapestProvider(activation.field, fieldToProviderMap)
+		}
+		p.activateField(activation.field, activation.parent, fieldToProviderMap)
+	}
+}
+
+// selectCheapestProvider returns the provider of @fieldName that adds the
+// lowest cost to the plan. Providers already in the plan add no cost. Ties
+// are broken by priority, and so is the selection when no cost is finite.
+func (p *plan) selectCheapestProvider(fieldName FieldName, fieldToProviderMap fieldProviderByName) FieldProvider {
+	alternatives := p.getEnabledAlternatives(fieldName, fieldToProviderMap)
+	cheapest := alternatives[0].provider
+	lowestCost := math.Inf(1)
+	for _, alternative := range alternatives {
+		_, cost := p.estimateCost(alternative, nil, fieldToProviderMap)
+		if cost < lowestCost {
+			cheapest, lowestCost = alternative.provider, cost
+		}
+	}
+	return cheapest
+}
+
+// estimateCost returns the providers that selecting @alternative adds to
+// the plan, besides the @added ones, and the cost they add. The providers of
+// its dependencies are selected greedily.
+func (p *plan) estimateCost(
+	alternative fieldAlternative,
+	added []FieldProvider,
+	fieldToProviderMap fieldProviderByName,
+) ([]FieldProvider, float64) {
+	cost := 0.0
+	if !p.processedProviders.Exists(alternative.provider) && !isProviderInArray(alternative.provider, added) {
+		added = append(added[:len(added):len(added)], alternative.provider)
+		cost += providerCost(alternative.provider, p.request)
+	}
+
+	for _, dependency := range getFieldDependencies(alternative.provider, alternative.field) {
+		dependency = fieldToProviderMap.Resolve(dependency)
+		if p.processedFields.Exists(dependency) {
+			continue
+		}
+		var cheapestAdded []FieldProvider
+		lowestCost := math.Inf(1)
+		for _, dependencyAlternative := range p.getSelectableAlternatives(dependency, fieldToProviderMap) {
+			dependencyAdded, dependencyCost := p.estimateCost(dependencyAlternative, added, fieldToProviderMap)
+			if dependencyCost < lowestCost {
+				cheapestAdded, lowestCost = dependencyAdded, dependencyCost
+			}
+		}
+		if cheapestAdded != nil {
+			added = cheapestAdded
+			cost += lowestCost
+		}
+	}
+	return added, cost
+}
+
+// getSelectableAlternatives returns the providers of @fieldName that may
+// still be selected.
+func (p *plan) getSelectableAlternatives(fieldName FieldName, fieldToProviderMap fieldProviderByName) []fieldAlternative {
+	if provider, isSelected := p.selectedProviders[fieldName]; isSelected {
+		field, _ := getField(provider, fieldName)
+		return []fieldAlternative{{provider: provider, field: field}}
+	}
+	return p.getEnabledAlternatives(fieldName, fieldToProviderMap)
+}
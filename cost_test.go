@@ -0,0 +1,153 @@
+package queryplanner
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type costEstimatingFieldProviderMock struct {
+	prioritizedFieldProviderMock
+	cost float64
+}
+
+func (m *costEstimatingFieldProviderMock) Cost(Request) float64 {
+	return m.cost
+}
+
+func newCostEstimatingFieldProviderMock(
+	name string,
+	priority int,
+	cost float64,
+	dependsOn []FieldName,
+	fields ...FieldName,
+) *costEstimatingFieldProviderMock {
+	provides := make([]Field, 0, len(fields))
+	for _, field := range fields {
+		provides = append(provides, newNoopField(field))
+	}
+	return &costEstimatingFieldProviderMock{
+		prioritizedFieldProviderMock: prioritizedFieldProviderMock{
+			fieldProviderMock: fieldProviderMock{name: name, dependsOn: dependsOn, provides: provides},
+			priority:          priority,
+		},
+		cost: cost,
+	}
+}
+
+func TestPlan_CostBasedSelection(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name              string
+		providers         []FieldProvider
+		options           []Option
+		request           []string
+		expectedSources   map[FieldName]string
+		expectedFallbacks map[FieldName][]string
+		expectedProviders []string
+	}{
+		{
+			name: "priority without cost based selection",
+			providers: []FieldProvider{
+				newCostEstimatingFieldProviderMock("gov", 0, 10, nil, "name"),
+				newCostEstimatingFieldProviderMock("person", 1, 3, nil, "name", "age"),
+			},
+			request:           []string{"name"},
+			expectedSources:   map[FieldName]string{"name": "gov"},
+			expectedFallbacks: map[FieldName][]string{"name": {"person"}},
+			expectedProviders: []string{"gov"},
+		},
+		{
+			name: "cheapest provider",
+			providers: []FieldProvider{
+				newCostEstimatingFieldProviderMock("gov", 0, 10, nil, "name"),
+				newCostEstimatingFieldProviderMock("person", 1, 3, nil, "name", "age"),
+			},
+			options:           []Option{WithCostBasedSelection()},
+			request:           []string{"name"},
+			expectedSources:   map[FieldName]string{"name": "person"},
+			expectedProviders: []string{"person"},
+		},
+		{
+			name: "provider executed anyway",
+			providers: []FieldProvider{
+				newCostEstimatingFieldProviderMock("gov", 0, 1, nil, "name"),
+				newCostEstimatingFieldProviderMock("person", 1, 5, nil, "name", "age"),
+			},
+			options:           []Option{WithCostBasedSelection()},
+			request:           []string{"name", "age"},
+			expectedSources:   map[FieldName]string{"name": "person", "age": "person"},
+			expectedProviders: []string{"person"},
+		},
+		{
+			name: "cost of the dependencies",
+			providers: []FieldProvider{
+				newCostEstimatingFieldProviderMock("gov", 0, 1, []FieldName{"token"}, "name"),
+				newCostEstimatingFieldProviderMock("person", 1, 5, []FieldName{"id"}, "name"),
+				newCostEstimatingFieldProviderMock("auth", 0, 10, nil, "token"),
+			},
+			options:           []Option{WithCostBasedSelection()},
+			request:           []string{"name"},
+			expectedSources:   map[FieldName]string{"name": "person", "id": IndexSource},
+			expectedProviders: []string{"person"},
+		},
+		{
+			name: "ties are broken by priority",
+			providers: []FieldProvider{
+				newCostEstimatingFieldProviderMock("person", 1, 1, nil, "name"),
+				newCostEstimatingFieldProviderMock("gov", 0, 1, nil, "name"),
+			},
+			options:           []Option{WithCostBasedSelection()},
+			request:           []string{"name"},
+			expectedSources:   map[FieldName]string{"name": "gov"},
+			expectedProviders: []string{"gov"},
+		},
+		{
+			name: "no finite cost",
+			providers: []FieldProvider{
+				newCostEstimatingFieldProviderMock("person", 1, math.NaN(), nil, "name"),
+				newCostEstimatingFieldProviderMock("gov", 0, math.Inf(1), nil, "name"),
+			},
+			options:           []Option{WithCostBasedSelection()},
+			request:           []string{"name"},
+			expectedSources:   map[FieldName]string{"name": "gov"},
+			expectedProviders: []string{"gov"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			indexProvider := &indexProviderMock{
+				provides: []Index{newNoopIndex("id")},
+			}
+			planner, err := NewQueryPlannerWithOptions(indexProvider, test.providers, test.options...)
+			require.NoError(t, err)
+
+			explanation := planner.NewPlan(&requestMock{test.request}).Explain()
+
+			sources := make(map[FieldName]string)
+			var fallbacks map[FieldName][]string
+			for _, field := range explanation.Fields {
+				sources[field.Name] = field.Source
+				if field.Fallbacks != nil {
+					if fallbacks == nil {
+						fallbacks = make(map[FieldName][]string)
+					}
+					fallbacks[field.Name] = field.Fallbacks
+				}
+			}
+			assert.Equal(t, test.expectedSources, sources)
+			assert.Equal(t, test.expectedFallbacks, fallbacks)
+
+			providers := make([]string, 0)
+			for _, provider := range explanation.Providers {
+				providers = append(providers, provider.Name)
+			}
+			assert.Equal(t, test.expectedProviders, providers)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package queryplanner
+
+import (
+	"github.com/arquivei/foundationkit/errors"
+)
+
+// documentAdapter derives the methods of fields from the structure of the
+// documents. See WithTaggedDocument and WithMapDocuments.
+type documentAdapter interface {
+	// checkField ensures that @field can be mapped to the documents.
+	checkField(field FieldName) error
+	clear(field FieldName, document Document)
+	get(field FieldName, document Document) (interface{}, bool)
+	// canGet tells if get can tell the documents where @field is not set
+	// from those where it is set to any value, so it may be projected.
+	canGet(field FieldName) bool
+	// set returns an error if @value does not fit @field.
+	set(field FieldName, document Document, value interface{}) error
+}
+
+func newDocumentAdapter(c config) (documentAdapter, error) {
+	const op = errors.Op("newDocumentAdapter")
+	switch {
+	case c.taggedDocumentSample != nil && c.mapDocuments:
+		return nil, errors.E(op, "tagged documents and map documents are mutually exclusive")
+	case c.mapDocuments && c.maxParallelism != 1:
+		// Go maps may not be written concurrently, and the providers read
+		// and write the documents directly.
+		return nil, errors.E(op, "map documents cannot be filled by concurrent providers",
+			errors.KV("maxParallelism", c.maxParallelism))
+	case c.taggedDocumentSample != nil:
+		taggedDocument, err := newTaggedDocument(c.taggedDocumentSample)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+		return taggedDocument, nil
+	case c.mapDocuments:
+		return mapDocumentAdapter{}, nil
+	}
+	return nil, nil
+}
+
+// clear clears @field in @document using @clear or, if it is nil, the
+// document adapter.
+func (c config) clear(field FieldName, clear func(Document), document Document) {
+	if clear != nil {
+		clear(document)
+		return
+	}
+	if c.documentAdapter != nil {
+		c.documentAdapter.clear(field, document)
+	}
+}
+
+// completeField returns @field with the methods it does not set derived from
+// the document adapter, if any. Fill is derived from FillValue, and fails if
+// the value does not fit the documents.
+func (c config) completeField(field Field) Field {
+	name := field.Name
+	var set func(Document, interface{}) error
+	if field.Set != nil {
+		fieldSet := field.Set
+		set = func(document Document, value interface{}) error {
+			fieldSet(document, value)
+			return nil
+		}
+	}
+	if adapter := c.documentAdapter; adapter != nil {
+		if field.Clear == nil {
+			field.Clear = func(document Document) { adapter.clear(name, document) }
+		}
+		// The fields whose zero value cannot be told from an unset field have
+		// no Get, so they are never taken as empty.
+		if field.Get == nil && adapter.canGet(name) {
+			field.Get = func(document Document) (interface{}, bool) { return adapter.get(name, document) }
+		}
+		if field.Set == nil {
+			set = func(document Document, value interface{}) error { return adapter.set(name, document, value) }
+			field.Set = func(document Document, value interface{}) { _ = set(document, value) }
+		}
+	}
+
+	if fillValue := field.FillValue; fillValue != nil && field.Fill == nil && set != nil {
+		field.Fill = func(index int, ec ExecutionContext) error {
+			value, err := fillValue(index, ec)
+			if err != nil || value == nil {
+				return err
+			}
+			return set(ec.Payload.Documents[index], value)
+		}
+	}
+	return field
+}
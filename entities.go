@@ -2,6 +2,10 @@ package queryplanner
 
 import (
 	"context"
+	"fmt"
+	"sync"
+
+	"github.com/arquivei/foundationkit/errors"
 )
 
 // Request is an interface for getting the requested fields of a Request
@@ -15,17 +19,89 @@ type Document interface{}
 
 // Field represents a valid field. It has a name and
 // functions for filling and cleaning itself.
+//
+// A field is filled either one document at a time by Fill or all at once by
+// BatchFill, which receives the whole Payload in the ExecutionContext and is
+// meant for providers that can load the data of all documents in a single
+// call. Alternatively, FillValue returns the value of the field in a
+// document, which is stored by Set. Exactly one of them must be set.
+// BatchFill must only fill the documents returned by
+// ExecutionContext.DocumentIndexes.
+//
+// Clear, Get and Set may be nil if the planner is created WithTaggedDocument
+// or WithMapDocuments.
 type Field struct {
-	Name  FieldName
-	Fill  func(int, ExecutionContext) error
-	Clear func(Document)
+	Name      FieldName
+	Fill      func(int, ExecutionContext) error
+	BatchFill func(ExecutionContext) error
+	// FillValue returns the value of the field in the document at the index.
+	// If the value is nil, the field is left empty.
+	FillValue func(int, ExecutionContext) (interface{}, error)
+	Clear     func(Document)
+
+	// Arguments are the arguments the field accepts when requested, e.g.
+	// Name(format=upper). Requests with other arguments, or with values
+	// that are not of the declared types, are rejected. The arguments are
+	// available to Fill and BatchFill through ExecutionContext.Arguments.
+	Arguments []FieldArgument
+
+	// Subtree tells that the field also provides the fields nested under it,
+	// e.g. a field Address provides Address.City. Nested fields that are not
+	// registered themselves are filled by it, whether they are requested or
+	// depended upon. Fields are not cleared if a field nested under them is
+	// requested, so the whole subtree is returned by Plan.Execute.
+	Subtree bool
+	// Children enriches the child documents held by the field, e.g. the
+	// dependents of a person, with a QueryPlanner of its own. The field is a
+	// subtree whose nested fields are the fields of the child planner: the
+	// requested or depended upon fields nested under it, e.g.
+	// Dependents.Name, are requested from the child plan, which is executed
+	// once for the children of all documents after the field is filled.
+	Children *ChildPlanner
+
+	// DependsOn are the fields this field depends on. If nil, the field
+	// depends on the provider's DependsOn. The fields of a provider are
+	// filled together, after the dependencies of all of them, unless that
+	// makes the providers depend on each other, e.g. a provider of x and of
+	// y depending on z, and a provider of z depending on x. Then the
+	// provider is executed in steps: x, then z, then y.
+	DependsOn []FieldName
+	// OptionalDependsOn are fields this field uses if they are available.
+	// An optional dependency is only activated if it is activated anyway,
+	// e.g. requested, or if it is provided by the IndexProvider. Its absence
+	// or failure does not prevent this field from being filled, so Fill must
+	// check whether its value is present. If nil, the field uses the
+	// provider's optional dependencies. See OptionalDependenciesProvider.
+	OptionalDependsOn []FieldName
+
+	// Get returns the value of the field in a document and whether it is
+	// set. Optional, but required by some features, such as Cache and
+	// Plan.Project.
+	Get func(Document) (interface{}, bool)
+	// Set sets the value of the field in a document. Optional, but required
+	// by some features, such as Cache.
+	Set func(Document, interface{})
+
+	// Cache enables the planner's EntityCache for this field. See
+	// WithEntityCache.
+	Cache *FieldCacheConfig
+
+	// MaxConcurrency is the number of documents that may be filled by Fill
+	// at the same time. If zero, the ConcurrentFieldProvider setting is used, if
+	// any. Otherwise, documents are filled one at a time.
+	MaxConcurrency int
 }
 
 // Index represents a valid index. It has a name and
-// functions for cleaning itself.
+// functions for cleaning itself. Clear may be nil if the planner is created
+// WithTaggedDocument or WithMapDocuments.
 type Index struct {
 	Name  FieldName
 	Clear func(Document)
+
+	// Get returns the value of the index in a document and whether it is
+	// set. Optional, but required by Plan.Project if the index is requested.
+	Get func(Document) (interface{}, bool)
 }
 
 // ExecutionContext is used during the filling process. It stores essential
@@ -35,9 +111,37 @@ type ExecutionContext struct {
 	Request Request
 	cache   *Cache
 	Payload *Payload
+
+	// sharedCache is the Cache shared by all the providers of the execution.
+	sharedCache *Cache
+
+	// documents are the documents BatchFill must fill. If nil, all of them.
+	documents []int
+	// arguments are the arguments of the field being filled.
+	arguments FieldArguments
+}
+
+// Arguments returns the arguments the field being filled was requested
+// with, if any. See Field.Arguments.
+func (e *ExecutionContext) Arguments() FieldArguments {
+	return e.arguments
+}
+
+// DocumentIndexes returns the indexes of the documents of the Payload that
+// BatchFill must fill. Documents found in the EntityCache, documents already
+// filled by a provider with higher priority and, in partial results mode,
+// documents whose dependencies failed are left out.
+func (e *ExecutionContext) DocumentIndexes() []int {
+	if e.documents == nil {
+		return allDocumentIndexes(e.Payload.Documents)
+	}
+	return e.documents
 }
 
 // Cache instatiates a new Cache.
+//
+// Each FieldProvider has its own Cache, shared by its fields. See
+// SharedCache to share data with other providers.
 func (e *ExecutionContext) Cache() *Cache {
 	if e.cache == nil {
 		e.cache = newCache()
@@ -45,38 +149,123 @@ func (e *ExecutionContext) Cache() *Cache {
 	return e.cache
 }
 
+// SharedCache returns the Cache shared by all the providers executed by a
+// Plan, so providers needing the same data load it once. Use Namespace to
+// avoid key collisions between unrelated providers.
+func (e *ExecutionContext) SharedCache() *Cache {
+	if e.sharedCache == nil {
+		e.sharedCache = newCache()
+	}
+	return e.sharedCache
+}
+
 func newCache() *Cache {
-	return &Cache{cache: make(map[interface{}]*CacheEntry)}
+	return &Cache{storage: &cacheStorage{cache: make(map[interface{}]*CacheEntry)}}
 }
 
 // CacheEntryLoader is a function that caches the result of the first call of function.
 type CacheEntryLoader func() (interface{}, error)
 
-// Cache caches the result of a function.
+// Cache caches the result of a function. It is safe for concurrent use:
+// concurrent loads of the same key are deduplicated, only the first loader
+// runs and the other callers wait for its result.
 type Cache struct {
+	storage   *cacheStorage
+	namespace string
+	ctx       context.Context
+}
+
+type cacheStorage struct {
+	mu    sync.Mutex
 	cache map[interface{}]*CacheEntry
 }
 
+type namespacedCacheKey struct {
+	namespace string
+	key       interface{}
+}
+
+// Namespace returns a view of the cache whose keys do not collide with keys
+// of other namespaces. Views of the same namespace share their entries.
+func (c *Cache) Namespace(namespace string) *Cache {
+	if c.namespace != "" {
+		namespace = c.namespace + "." + namespace
+	}
+	return &Cache{storage: c.storage, namespace: namespace, ctx: c.ctx}
+}
+
+// withContext returns a view of the cache that stops waiting for loads
+// made by others when @ctx is done.
+func (c *Cache) withContext(ctx context.Context) *Cache {
+	return &Cache{storage: c.storage, namespace: c.namespace, ctx: ctx}
+}
+
 // GetOrLoad tries to retrieve an existing element from the cache by an indexed `key` . If there is already an entry for
 // (CacheEntry) the key, the cached content is returned. If there is not a cached value, then `loader` (CacheEntryLeader)
 // is executed and its results are cached using the provided `key` as index.
+//
+// The caches returned by ExecutionContext.Cache and SharedCache stop waiting
+// for a concurrent load when the execution context is done.
 func (c *Cache) GetOrLoad(key interface{}, loader CacheEntryLoader) (interface{}, error) {
-	result, ok := c.cache[key]
-	if ok {
-		return result.data, result.err
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return c.GetOrLoadContext(ctx, key, loader)
+}
+
+// GetOrLoadContext is like GetOrLoad, but returns ctx.Err() if @ctx is done
+// while waiting for another goroutine to load the same `key`. The load
+// itself is not interrupted and its result is still cached.
+func (c *Cache) GetOrLoadContext(ctx context.Context, key interface{}, loader CacheEntryLoader) (interface{}, error) {
+	if c.namespace != "" {
+		key = namespacedCacheKey{namespace: c.namespace, key: key}
+	}
+
+	c.storage.mu.Lock()
+	entry, ok := c.storage.cache[key]
+	if !ok {
+		entry = &CacheEntry{done: make(chan struct{})}
+		c.storage.cache[key] = entry
 	}
-	data, err := loader()
-	c.cache[key] = &CacheEntry{
-		data: data,
-		err:  err,
+	c.storage.mu.Unlock()
+
+	if !ok {
+		c.load(key, entry, loader)
+		return entry.data, entry.err
 	}
-	return data, err
+
+	select {
+	case <-entry.done:
+		return entry.data, entry.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Cache) load(key interface{}, entry *CacheEntry, loader CacheEntryLoader) {
+	loaded := false
+	defer func() {
+		if !loaded {
+			// The loader panicked: release the waiters and let the next
+			// caller try again.
+			entry.err = errors.E("cache loader panicked", errors.KV("key", key))
+			c.storage.mu.Lock()
+			delete(c.storage.cache, key)
+			c.storage.mu.Unlock()
+		}
+		close(entry.done)
+	}()
+
+	entry.data, entry.err = loader()
+	loaded = true
 }
 
 // CacheEntry is the stored element in Cache.
 type CacheEntry struct {
 	data interface{}
 	err  error
+	done chan struct{}
 }
 
 // Payload stores the slice of documents and also supports an arbitrary data
@@ -84,7 +273,42 @@ type CacheEntry struct {
 type Payload struct {
 	Documents  []Document
 	CustomData interface{}
+	// Errors are the fields that could not be filled. It is only set in
+	// partial results mode. See WithPartialResults.
+	Errors []FieldError
+}
+
+// FieldError records a field that could not be filled in a document, either
+// because its Fill failed or because a field it depends on failed.
+type FieldError struct {
+	DocumentIndex int
+	Field         FieldName
+	// Err is the error returned when filling the field. It is nil if the
+	// field was skipped.
+	Err error
+	// SkippedBecause is the failed dependency that caused the field to be
+	// skipped.
+	SkippedBecause FieldName
 }
 
-// FieldName is a string representing a valid field.
+func (f FieldError) Error() string {
+	if f.Err == nil {
+		return fmt.Sprintf("field %s of document %d skipped: dependency %s failed", f.Field, f.DocumentIndex, f.SkippedBecause)
+	}
+	return fmt.Sprintf("field %s of document %d failed: %s", f.Field, f.DocumentIndex, f.Err)
+}
+
+// FieldName is a string representing a valid field. Nested fields are
+// separated by dots, e.g. Address.City. See Field.Subtree.
+//
+// Requested fields may also be wildcards: "*" requests all the registered
+// fields and "Address.*" all the registered fields nested under Address.
 type FieldName string
+
+// fieldPathSeparator separates the names of nested fields.
+const fieldPathSeparator = "."
+
+// allFieldsWildcard requests all the registered fields, and a requested
+// field ending with fieldPathSeparator followed by it requests all the
+// registered fields nested under its prefix.
+const allFieldsWildcard = "*"
@@ -1,13 +1,19 @@
 package queryplanner
 
+import (
+	"sort"
+	"strings"
+)
+
 func newFieldProviderByName() fieldProviderByName {
 	return fieldProviderByName{
-		providersByName: make(map[FieldName]FieldProvider),
+		providersByName: make(map[FieldName][]FieldProvider),
 	}
 }
 
 type fieldProviderByName struct {
-	providersByName map[FieldName]FieldProvider
+	// providersByName holds the providers of each field in priority order.
+	providersByName map[FieldName][]FieldProvider
 }
 
 func (f *fieldProviderByName) Length() int {
@@ -23,11 +29,85 @@ func (f *fieldProviderByName) GetFieldNames() []string {
 	return fieldNames
 }
 
+// GetByName returns the provider of @field with the highest priority.
 func (f *fieldProviderByName) GetByName(field FieldName) (FieldProvider, bool) {
-	provider, ok := f.providersByName[field]
-	return provider, ok
+	providers, ok := f.providersByName[field]
+	if !ok {
+		return nil, false
+	}
+	return providers[0], true
+}
+
+// GetAllByName returns all the providers of @field in priority order.
+func (f *fieldProviderByName) GetAllByName(field FieldName) []FieldProvider {
+	return f.providersByName[field]
+}
+
+// GetAlternativesByName returns the providers of @field in priority order,
+// along with their declaration of the field.
+func (f *fieldProviderByName) GetAlternativesByName(field FieldName) []fieldAlternative {
+	providers := f.providersByName[field]
+	alternatives := make([]fieldAlternative, 0, len(providers))
+	for _, provider := range providers {
+		declaration, _ := getField(provider, field)
+		alternatives = append(alternatives, fieldAlternative{provider: provider, field: declaration})
+	}
+	return alternatives
 }
 
+// Add sets @provider as the only provider of @field.
 func (f *fieldProviderByName) Add(field FieldName, provider FieldProvider) {
-	f.providersByName[field] = provider
+	f.providersByName[field] = []FieldProvider{provider}
+}
+
+// AddAlternative adds @provider to the providers of @field, according to
+// its priority.
+func (f *fieldProviderByName) AddAlternative(field FieldName, provider FieldProvider) {
+	providers := append(f.providersByName[field], provider)
+	sort.SliceStable(providers, func(i, j int) bool {
+		return providerPriority(providers[i]) < providerPriority(providers[j])
+	})
+	f.providersByName[field] = providers
+}
+
+// Resolve returns the field that provides @field: its closest ancestor that
+// is a subtree if @field is not registered itself, otherwise @field. Fields
+// starting with '_' are always provided by the index, so they are returned
+// as they are. See Field.Subtree.
+func (f *fieldProviderByName) Resolve(field FieldName) FieldName {
+	if _, ok := f.providersByName[field]; ok || field == "" || field[0] == '_' {
+		return field
+	}
+	ancestor := string(field)
+	for {
+		separator := strings.LastIndex(ancestor, fieldPathSeparator)
+		if separator < 0 {
+			return field
+		}
+		ancestor = ancestor[:separator]
+		if f.IsSubtree(FieldName(ancestor)) {
+			return FieldName(ancestor)
+		}
+	}
+}
+
+// IsSubtree tells if any provider of @field declares it as a subtree or
+// has a child planner for it.
+func (f *fieldProviderByName) IsSubtree(field FieldName) bool {
+	for _, alternative := range f.GetAlternativesByName(field) {
+		if alternative.field.Subtree || alternative.field.Children != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// HasChildren tells if any provider of @field has a child planner for it.
+func (f *fieldProviderByName) HasChildren(field FieldName) bool {
+	for _, alternative := range f.GetAlternativesByName(field) {
+		if alternative.field.Children != nil {
+			return true
+		}
+	}
+	return false
 }
@@ -54,3 +54,25 @@ func Test_fieldProviderByName_GetFieldNames(t *testing.T) {
 	expected := []string{"Field_1", "Field_2", "Field_3", "Field_4"}
 	assert.ElementsMatch(t, expected, fp.GetFieldNames())
 }
+
+func Test_fieldProviderByName_Resolve(t *testing.T) {
+	t.Parallel()
+
+	fp := newFieldProviderByName()
+	fp.Add("address", &fieldProviderMock{provides: []Field{{Name: "address", Subtree: true}}})
+	fp.Add("address.geo.lat", &fieldProviderMock{provides: []Field{{Name: "address.geo.lat"}}})
+	fp.Add("company", &fieldProviderMock{provides: []Field{{Name: "company"}}})
+
+	tests := map[FieldName]FieldName{
+		"address":          "address",
+		"address.city":     "address",
+		"address.geo.long": "address",
+		"address.geo.lat":  "address.geo.lat",
+		"company.name":     "company.name",
+		"_address.city":    "_address.city",
+		"other":            "other",
+	}
+	for field, expected := range tests {
+		assert.Equal(t, expected, fp.Resolve(field), field)
+	}
+}
@@ -1,8 +1,12 @@
 package queryplanner
 
 import (
+	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/arquivei/foundationkit/errors"
 	"github.com/stretchr/testify/assert"
@@ -57,3 +61,124 @@ func Test_cache_ExecuteOrRetrieve_CachingResult(t *testing.T) {
 	assert.Equal(t, "B_1", result.B)
 	assert.Equal(t, calledTimes, 1)
 }
+
+func Test_cache_GetOrLoad_Concurrent(t *testing.T) {
+	t.Parallel()
+	ctx := ExecutionContext{}
+	cache := ctx.Cache()
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 50)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = cache.GetOrLoad(i%5, func() (interface{}, error) {
+				return fmt.Sprintf("value_%d", i%5), nil
+			})
+		}()
+	}
+	wg.Wait()
+
+	for i, result := range results {
+		assert.Equal(t, fmt.Sprintf("value_%d", i%5), result)
+	}
+}
+
+func Test_cache_Namespace(t *testing.T) {
+	t.Parallel()
+	ctx := ExecutionContext{}
+	cache := ctx.Cache()
+
+	load := func(value string) CacheEntryLoader {
+		return func() (interface{}, error) { return value, nil }
+	}
+
+	gov, _ := cache.Namespace("gov").GetOrLoad("biscoito", load("gov"))
+	covid, _ := cache.Namespace("covid").GetOrLoad("biscoito", load("covid"))
+	root, _ := cache.GetOrLoad("biscoito", load("root"))
+	govAgain, _ := cache.Namespace("gov").GetOrLoad("biscoito", load("gov again"))
+	nested, _ := cache.Namespace("gov").Namespace("covid").GetOrLoad("biscoito", load("nested"))
+
+	assert.Equal(t, "gov", gov)
+	assert.Equal(t, "covid", covid)
+	assert.Equal(t, "root", root)
+	assert.Equal(t, "gov", govAgain)
+	assert.Equal(t, "nested", nested)
+}
+
+func Test_cache_GetOrLoad_Singleflight(t *testing.T) {
+	t.Parallel()
+	ctx := ExecutionContext{}
+	cache := ctx.Cache()
+
+	var calledTimes atomic.Int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	results := make([]interface{}, 10)
+	errs := make([]error, 10)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = cache.GetOrLoad("biscoito", func() (interface{}, error) {
+				calledTimes.Add(1)
+				<-release
+				return "bolacha", errors.E("err biscoito")
+			})
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calledTimes.Load())
+	for i := range results {
+		assert.Equal(t, "bolacha", results[i])
+		assert.EqualError(t, errs[i], "err biscoito")
+	}
+}
+
+func Test_cache_GetOrLoadContext_CanceledWhileWaiting(t *testing.T) {
+	t.Parallel()
+	ctx := ExecutionContext{}
+	cache := ctx.Cache()
+
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		_, _ = cache.GetOrLoad("biscoito", func() (interface{}, error) {
+			close(loading)
+			<-release
+			return "bolacha", nil
+		})
+	}()
+	<-loading
+
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := cache.GetOrLoadContext(canceledCtx, "biscoito", func() (interface{}, error) {
+		return "should not be called", nil
+	})
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	close(release)
+	result, err = cache.GetOrLoadContext(context.Background(), "biscoito", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "bolacha", result)
+}
+
+func Test_cache_GetOrLoad_LoaderPanics(t *testing.T) {
+	t.Parallel()
+	ctx := ExecutionContext{}
+	cache := ctx.Cache()
+
+	assert.Panics(t, func() {
+		_, _ = cache.GetOrLoad("biscoito", func() (interface{}, error) { panic("oops") })
+	})
+
+	result, err := cache.GetOrLoad("biscoito", func() (interface{}, error) { return "bolacha", nil })
+	assert.NoError(t, err)
+	assert.Equal(t, "bolacha", result)
+}
@@ -0,0 +1,227 @@
+package queryplanner
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+)
+
+// FieldCacheConfig configures how the values of a field are stored in the
+// EntityCache. The field must define Get and Set, which are used to read
+// the value after Fill and to restore it on cache hits.
+//
+// Cached values are shared between requests and must not be mutated.
+type FieldCacheConfig struct {
+	// Key returns the key that identifies the document, e.g. its ID.
+	// Documents without a key are neither looked up nor stored.
+	Key func(Document) (string, bool)
+	// TTL is how long a value is kept in the cache.
+	TTL time.Duration
+	// NegativeTTL is how long the absence of a value (Get returns false
+	// after Fill) is kept in the cache. Zero disables negative caching.
+	NegativeTTL time.Duration
+}
+
+// EntityCacheKey identifies the value of a field in a document.
+type EntityCacheKey struct {
+	Field    FieldName
+	Document string
+	// Arguments are the arguments the field was requested with, formatted,
+	// e.g. format=upper. See Field.Arguments.
+	Arguments string
+}
+
+// EntityCacheEntry is the value stored in a CacheBackend. Found is false for
+// negative entries, which record that the field has no value.
+type EntityCacheEntry struct {
+	Value interface{}
+	Found bool
+}
+
+// CacheBackend stores the entries of an EntityCache. Implementations must
+// be safe for concurrent use and must not return expired entries.
+type CacheBackend interface {
+	Get(key EntityCacheKey) (EntityCacheEntry, bool)
+	Set(key EntityCacheKey, entry EntityCacheEntry, ttl time.Duration)
+}
+
+// EntityCache caches field values across requests. See WithEntityCache.
+type EntityCache struct {
+	backend CacheBackend
+
+	hits         atomic.Uint64
+	negativeHits atomic.Uint64
+	misses       atomic.Uint64
+}
+
+// EntityCacheStats are the lookup statistics of an EntityCache.
+type EntityCacheStats struct {
+	Hits         uint64
+	NegativeHits uint64
+	Misses       uint64
+}
+
+// NewEntityCache returns an EntityCache that stores its entries in @backend.
+func NewEntityCache(backend CacheBackend) *EntityCache {
+	return &EntityCache{backend: backend}
+}
+
+// Stats returns the lookup statistics of the cache.
+func (c *EntityCache) Stats() EntityCacheStats {
+	return EntityCacheStats{
+		Hits:         c.hits.Load(),
+		NegativeHits: c.negativeHits.Load(),
+		Misses:       c.misses.Load(),
+	}
+}
+
+// load sets the cached values of @field requested with @arguments in the
+// documents at @indexes and returns the indexes of the documents that must
+// be filled.
+func (c *EntityCache) load(field Field, arguments string, documents []Document, indexes []int) []int {
+	missed := make([]int, 0, len(indexes))
+	for _, index := range indexes {
+		document := documents[index]
+		key, ok := field.Cache.Key(document)
+		if !ok {
+			missed = append(missed, index)
+			continue
+		}
+
+		entry, found := c.backend.Get(EntityCacheKey{Field: field.Name, Document: key, Arguments: arguments})
+		switch {
+		case !found:
+			c.misses.Add(1)
+			missed = append(missed, index)
+		case !entry.Found:
+			c.negativeHits.Add(1)
+		default:
+			c.hits.Add(1)
+			field.Set(document, entry.Value)
+		}
+	}
+	return missed
+}
+
+// store caches the values of @field requested with @arguments in the
+// documents at @indexes.
+func (c *EntityCache) store(field Field, arguments string, documents []Document, indexes []int) {
+	for _, index := range indexes {
+		key, ok := field.Cache.Key(documents[index])
+		if !ok {
+			continue
+		}
+
+		value, found := field.Get(documents[index])
+		ttl := field.Cache.TTL
+		if !found {
+			ttl = field.Cache.NegativeTTL
+		}
+		if ttl <= 0 {
+			continue
+		}
+		cacheKey := EntityCacheKey{Field: field.Name, Document: key, Arguments: arguments}
+		c.backend.Set(cacheKey, EntityCacheEntry{Value: value, Found: found}, ttl)
+	}
+}
+
+func checkFieldCacheConfig(field Field) error {
+	const op = errors.Op("checkFieldCacheConfig")
+	switch {
+	case field.Get == nil:
+		return errors.E(op, "cached field has no `get` method")
+	case field.Set == nil:
+		return errors.E(op, "cached field has no `set` method")
+	case field.Cache.Key == nil:
+		return errors.E(op, "cached field has no `key` method")
+	case field.Cache.TTL <= 0:
+		return errors.E(op, "cached field has no positive TTL")
+	}
+	return nil
+}
+
+// MemoryCacheBackend is an in-memory CacheBackend that evicts the least
+// recently used entries when it is full.
+type MemoryCacheBackend struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[EntityCacheKey]*list.Element
+	lru        *list.List
+	evictions  uint64
+	now        func() time.Time
+}
+
+type memoryCacheItem struct {
+	key       EntityCacheKey
+	entry     EntityCacheEntry
+	expiresAt time.Time
+}
+
+// NewMemoryCacheBackend returns a MemoryCacheBackend holding at most
+// @maxEntries entries. If @maxEntries is lower than 1, it is unbounded.
+func NewMemoryCacheBackend(maxEntries int) *MemoryCacheBackend {
+	return &MemoryCacheBackend{
+		maxEntries: maxEntries,
+		entries:    make(map[EntityCacheKey]*list.Element),
+		lru:        list.New(),
+		now:        time.Now,
+	}
+}
+
+// Get returns the entry stored under @key, if it has not expired.
+func (b *MemoryCacheBackend) Get(key EntityCacheKey) (EntityCacheEntry, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	element, ok := b.entries[key]
+	if !ok {
+		return EntityCacheEntry{}, false
+	}
+	item := element.Value.(*memoryCacheItem) //nolint:forcetypeassert
+	if !b.now().Before(item.expiresAt) {
+		b.lru.Remove(element)
+		delete(b.entries, key)
+		return EntityCacheEntry{}, false
+	}
+	b.lru.MoveToFront(element)
+	return item.entry, true
+}
+
+// Set stores @entry under @key for @ttl.
+func (b *MemoryCacheBackend) Set(key EntityCacheKey, entry EntityCacheEntry, ttl time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	item := &memoryCacheItem{key: key, entry: entry, expiresAt: b.now().Add(ttl)}
+	if element, ok := b.entries[key]; ok {
+		element.Value = item
+		b.lru.MoveToFront(element)
+		return
+	}
+	b.entries[key] = b.lru.PushFront(item)
+
+	if b.maxEntries > 0 && b.lru.Len() > b.maxEntries {
+		oldest := b.lru.Back()
+		b.lru.Remove(oldest)
+		delete(b.entries, oldest.Value.(*memoryCacheItem).key) //nolint:forcetypeassert
+		b.evictions++
+	}
+}
+
+// Len returns the number of entries in the backend, including expired
+// entries not yet removed.
+func (b *MemoryCacheBackend) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lru.Len()
+}
+
+// Evictions returns how many entries were evicted to respect the size limit.
+func (b *MemoryCacheBackend) Evictions() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.evictions
+}
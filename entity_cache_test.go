@@ -0,0 +1,178 @@
+package queryplanner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arquivei/foundationkit/ref"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryCacheBackend_LRU(t *testing.T) {
+	t.Parallel()
+	backend := NewMemoryCacheBackend(2)
+
+	backend.Set(EntityCacheKey{Field: "a", Document: "1"}, EntityCacheEntry{Value: "a1", Found: true}, time.Minute)
+	backend.Set(EntityCacheKey{Field: "a", Document: "2"}, EntityCacheEntry{Value: "a2", Found: true}, time.Minute)
+	_, _ = backend.Get(EntityCacheKey{Field: "a", Document: "1"})
+	backend.Set(EntityCacheKey{Field: "a", Document: "3"}, EntityCacheEntry{Value: "a3", Found: true}, time.Minute)
+
+	entry, found := backend.Get(EntityCacheKey{Field: "a", Document: "1"})
+	assert.True(t, found)
+	assert.Equal(t, EntityCacheEntry{Value: "a1", Found: true}, entry)
+
+	_, found = backend.Get(EntityCacheKey{Field: "a", Document: "2"})
+	assert.False(t, found)
+
+	assert.Equal(t, 2, backend.Len())
+	assert.Equal(t, uint64(1), backend.Evictions())
+}
+
+func TestMemoryCacheBackend_TTL(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2022, 5, 31, 0, 0, 0, 0, time.UTC)
+	backend := NewMemoryCacheBackend(0)
+	backend.now = func() time.Time { return now }
+
+	key := EntityCacheKey{Field: "a", Document: "1"}
+	backend.Set(key, EntityCacheEntry{Found: false}, time.Minute)
+
+	entry, found := backend.Get(key)
+	assert.True(t, found)
+	assert.False(t, entry.Found)
+
+	now = now.Add(time.Minute)
+	_, found = backend.Get(key)
+	assert.False(t, found)
+	assert.Equal(t, 0, backend.Len())
+}
+
+//nolint:forcetypeassert
+func TestPlanExecution_EntityCache(t *testing.T) {
+	t.Parallel()
+
+	filled := []string{}
+	provider := &fieldProviderMock{
+		name:      "a-provider",
+		dependsOn: []FieldName{"d"},
+		provides: []Field{
+			{
+				Name: "a",
+				Fill: func(index int, ec ExecutionContext) error {
+					doc := ec.Payload.Documents[index].(*document)
+					filled = append(filled, *doc.d)
+					if *doc.d != "unknown" {
+						doc.a = ref.Of("a of " + *doc.d)
+					}
+					return nil
+				},
+				Clear: func(d Document) { d.(*document).a = nil },
+				Get: func(d Document) (interface{}, bool) {
+					doc := d.(*document)
+					return doc.a, doc.a != nil
+				},
+				Set: func(d Document, value interface{}) { d.(*document).a = value.(*string) },
+				Cache: &FieldCacheConfig{
+					Key:         func(d Document) (string, bool) { return *d.(*document).d, true },
+					TTL:         time.Minute,
+					NegativeTTL: time.Minute,
+				},
+			},
+		},
+	}
+	newIndexProvider := func(values ...string) *indexProviderMock {
+		docs := make([]*document, 0, len(values))
+		for _, value := range values {
+			docs = append(docs, &document{d: ref.Of(value)})
+		}
+		return &indexProviderMock{
+			provides: []Index{newNoopIndex("d")},
+			data:     &Payload{Documents: wrapDocuments(docs)},
+		}
+	}
+
+	cache := NewEntityCache(NewMemoryCacheBackend(10))
+
+	planner, err := NewQueryPlannerWithOptions(newIndexProvider("1", "unknown"), []FieldProvider{provider}, WithEntityCache(cache))
+	require.NoError(t, err)
+	_, err = planner.NewPlan(&requestMock{[]string{"a"}}).Execute(context.Background())
+	require.NoError(t, err)
+
+	planner, err = NewQueryPlannerWithOptions(newIndexProvider("1", "2", "unknown"), []FieldProvider{provider}, WithEntityCache(cache))
+	require.NoError(t, err)
+	data, err := planner.NewPlan(&requestMock{[]string{"a"}}).Execute(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"1", "unknown", "2"}, filled)
+	assert.Equal(t, []*document{
+		{a: ref.Of("a of 1"), d: ref.Of("1")},
+		{a: ref.Of("a of 2"), d: ref.Of("2")},
+		{d: ref.Of("unknown")},
+	}, unwrapDocuments(data.Documents))
+	assert.Equal(t, EntityCacheStats{Hits: 1, NegativeHits: 1, Misses: 3}, cache.Stats())
+}
+
+func TestNewQueryPlanner_EntityCacheConfig(t *testing.T) {
+	t.Parallel()
+
+	field := newNoopField("a")
+	field.Cache = &FieldCacheConfig{TTL: time.Minute}
+	provider := &fieldProviderMock{name: "a-provider", provides: []Field{field}}
+
+	_, err := NewQueryPlanner(&indexProviderMock{}, provider)
+	assert.EqualError(t, err, "queryplanner.NewQueryPlanner: checkIfFieldProvidersAreDeclaredCorrectly: checkMethodsFromFieldProvider: checkFieldCacheConfig: cached field has no `get` method [fieldName=a]")
+}
+
+//nolint:forcetypeassert
+func TestPlanExecution_EntityCache_BatchFill(t *testing.T) {
+	t.Parallel()
+
+	batches := [][]int{}
+	provider := &fieldProviderMock{
+		name:      "a-provider",
+		dependsOn: []FieldName{"d"},
+		provides: []Field{{
+			Name: "a",
+			BatchFill: func(ec ExecutionContext) error {
+				batches = append(batches, ec.DocumentIndexes())
+				for _, index := range ec.DocumentIndexes() {
+					ec.Payload.Documents[index].(MapDocument)["a"] = "a of " + ec.Payload.Documents[index].(MapDocument)["d"].(string)
+				}
+				return nil
+			},
+			Cache: &FieldCacheConfig{
+				Key: func(d Document) (string, bool) { return d.(MapDocument)["d"].(string), true },
+				TTL: time.Minute,
+			},
+		}},
+	}
+	newIndexProvider := func(values ...string) *indexProviderMock {
+		return &indexProviderMock{
+			provides: []Index{{Name: "d"}},
+			execute: func(*indexProviderMock, context.Context, Request, []string) (*Payload, error) {
+				documents := make([]Document, 0, len(values))
+				for _, value := range values {
+					documents = append(documents, MapDocument{"d": value})
+				}
+				return &Payload{Documents: documents}, nil
+			},
+		}
+	}
+
+	cache := NewEntityCache(NewMemoryCacheBackend(10))
+
+	planner, err := NewQueryPlannerWithOptions(newIndexProvider("1"), []FieldProvider{provider}, WithMapDocuments(), WithEntityCache(cache))
+	require.NoError(t, err)
+	_, err = planner.NewPlan(&requestMock{[]string{"a"}}).Execute(context.Background())
+	require.NoError(t, err)
+
+	planner, err = NewQueryPlannerWithOptions(newIndexProvider("1", "2"), []FieldProvider{provider}, WithMapDocuments(), WithEntityCache(cache))
+	require.NoError(t, err)
+	data, err := planner.NewPlan(&requestMock{[]string{"a"}}).Execute(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]int{{0}, {1}}, batches)
+	assert.Equal(t, []Document{MapDocument{"a": "a of 1"}, MapDocument{"a": "a of 2"}}, data.Documents)
+}
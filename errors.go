@@ -0,0 +1,83 @@
+package queryplanner
+
+// ErrCycle is returned when creating a QueryPlanner whose dependencies have a
+// cycle. It matches any ErrCycle with errors.Is.
+type ErrCycle struct {
+	// Path is the cycle between fields, starting and ending with the same
+	// field.
+	Path []FieldName
+}
+
+func (e *ErrCycle) Error() string {
+	return "cycle found in field dependency"
+}
+
+// Is tells if @target is an ErrCycle.
+func (e *ErrCycle) Is(target error) bool {
+	_, ok := target.(*ErrCycle)
+	return ok
+}
+
+// ErrDuplicateProvider is returned when creating a QueryPlanner with two
+// providers with the same priority for the same field. It matches any
+// ErrDuplicateProvider with errors.Is.
+type ErrDuplicateProvider struct {
+	Field FieldName
+	// Providers are the names of the registered provider and of the one
+	// being registered.
+	Providers []string
+}
+
+func (e *ErrDuplicateProvider) Error() string {
+	return "two providers for the same field"
+}
+
+// Is tells if @target is an ErrDuplicateProvider.
+func (e *ErrDuplicateProvider) Is(target error) bool {
+	_, ok := target.(*ErrDuplicateProvider)
+	return ok
+}
+
+// ErrUnsupportedIndexFields is returned when a Plan needs fields from the
+// IndexProvider that it does not provide. It matches any
+// ErrUnsupportedIndexFields with errors.Is.
+type ErrUnsupportedIndexFields struct {
+	Fields []FieldName
+}
+
+func (e *ErrUnsupportedIndexFields) Error() string {
+	return "unsupported fields by index"
+}
+
+// Is tells if @target is an ErrUnsupportedIndexFields.
+func (e *ErrUnsupportedIndexFields) Is(target error) bool {
+	_, ok := target.(*ErrUnsupportedIndexFields)
+	return ok
+}
+
+// ErrFillFailed is returned by Plan.Execute when a field could not be filled.
+// It matches any ErrFillFailed with errors.Is and unwraps to the error
+// returned by Fill or BatchFill.
+type ErrFillFailed struct {
+	// Provider is the name of the last provider that tried to fill the field.
+	Provider string
+	Field    FieldName
+	// DocumentIndex is the first document in which the field could not be
+	// filled.
+	DocumentIndex int
+	Err           error
+}
+
+func (e *ErrFillFailed) Error() string {
+	return e.Err.Error()
+}
+
+// Is tells if @target is an ErrFillFailed.
+func (e *ErrFillFailed) Is(target error) bool {
+	_, ok := target.(*ErrFillFailed)
+	return ok
+}
+
+func (e *ErrFillFailed) Unwrap() error {
+	return e.Err
+}
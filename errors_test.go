@@ -0,0 +1,114 @@
+package queryplanner
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewQueryPlanner_TypedErrors(t *testing.T) {
+	t.Parallel()
+
+	newField := func(name FieldName, dependsOn ...FieldName) Field {
+		field := newNoopField(name)
+		field.DependsOn = dependsOn
+		return field
+	}
+
+	tests := []struct {
+		name          string
+		providers     []FieldProvider
+		expectedErr   error
+		expectedMatch error
+	}{
+		{
+			name: "field cycle",
+			providers: []FieldProvider{
+				&fieldProviderMock{name: "a-provider", provides: []Field{newField("a", "b")}},
+				&fieldProviderMock{name: "b-provider", provides: []Field{newField("b", "c")}},
+				&fieldProviderMock{name: "c-provider", provides: []Field{newField("c", "a")}},
+			},
+			expectedErr: &ErrCycle{Path: []FieldName{"a", "b", "c", "a"}},
+		},
+		{
+			name: "field cycle reached from outside",
+			providers: []FieldProvider{
+				&fieldProviderMock{name: "a-provider", provides: []Field{newField("a", "b")}},
+				&fieldProviderMock{name: "b-provider", provides: []Field{newField("b", "c")}},
+				&fieldProviderMock{name: "c-provider", provides: []Field{newField("c", "b")}},
+			},
+			expectedErr: &ErrCycle{Path: []FieldName{"b", "c", "b"}},
+		},
+		{
+			name: "duplicate provider",
+			providers: []FieldProvider{
+				&fieldProviderMock{name: "a-provider", provides: []Field{newField("a")}},
+				&fieldProviderMock{name: "a-provider-2", provides: []Field{newField("a")}},
+			},
+			expectedErr: &ErrDuplicateProvider{Field: "a", Providers: []string{"a-provider", "a-provider-2"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewQueryPlanner(&indexProviderMock{}, test.providers...)
+			require.Error(t, err)
+			assert.ErrorIs(t, err, test.expectedErr)
+
+			switch expected := test.expectedErr.(type) {
+			case *ErrCycle:
+				var actual *ErrCycle
+				require.True(t, stderrors.As(err, &actual))
+				assert.Equal(t, expected, actual)
+				assert.NotErrorIs(t, err, &ErrDuplicateProvider{})
+			case *ErrDuplicateProvider:
+				var actual *ErrDuplicateProvider
+				require.True(t, stderrors.As(err, &actual))
+				assert.Equal(t, expected, actual)
+				assert.NotErrorIs(t, err, &ErrCycle{})
+			}
+		})
+	}
+}
+
+func TestPlan_Execute_TypedErrors(t *testing.T) {
+	t.Parallel()
+
+	errFilling := errors.New("problem filling a")
+	providers := []FieldProvider{
+		&fieldProviderMock{
+			name: "a-provider",
+			provides: []Field{newFillField("a", func(index int, _ ExecutionContext) error {
+				if index == 1 {
+					return errFilling
+				}
+				return nil
+			})},
+		},
+	}
+	indexProvider := &indexProviderMock{
+		data: &Payload{Documents: wrapDocuments([]*document{{}, {}, {}})},
+	}
+
+	planner, err := NewQueryPlanner(indexProvider, providers...)
+	require.NoError(t, err)
+
+	_, err = planner.NewPlan(&requestMock{[]string{"a"}}).Execute(context.Background())
+	assert.EqualError(t, err, "queryplanner.Plan.Execute: planExecution.start: planExecution.executeProvider: problem filling a")
+	assert.ErrorIs(t, err, errFilling)
+	assert.ErrorIs(t, err, &ErrFillFailed{})
+	var fillFailed *ErrFillFailed
+	require.True(t, stderrors.As(err, &fillFailed))
+	assert.Equal(t, &ErrFillFailed{Provider: "a-provider", Field: "a", DocumentIndex: 1, Err: errFilling}, fillFailed)
+
+	_, err = planner.NewPlan(&requestMock{[]string{"b", "a"}}).Execute(context.Background())
+	assert.EqualError(t, err, "queryplanner.Plan.Execute: checkIfIndexHasTheNecessaryFields: unsupported fields by index [fields=b]")
+	var unsupportedFields *ErrUnsupportedIndexFields
+	require.True(t, stderrors.As(err, &unsupportedFields))
+	assert.Equal(t, []FieldName{"b"}, unsupportedFields.Fields)
+}
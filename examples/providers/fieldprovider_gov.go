@@ -6,7 +6,8 @@ import (
 	"github.com/arquivei/queryplanner"
 )
 
-type GovProviderKey string
+// govProviderKey is the cache key of the personal info of all the documents.
+type govProviderKey struct{}
 
 type PersonalInfo struct {
 	Name string
@@ -32,17 +33,23 @@ func (p *GovDatabaseProvider) Provides() []queryplanner.Field {
 			// When a provider depends on information from other providers,
 			// the library will use the names to match
 			Name: "Name",
-			// The fill function receives the index of the document i and the execution context.
-			// It must fill the document with the information.
-			Fill: func(i int, ec queryplanner.ExecutionContext) error {
+			// The batch fill function receives the execution context with all the documents.
+			// It must fill the documents returned by ec.DocumentIndexes, which allows the
+			// provider to query the gov database once instead of once per document.
+			BatchFill: func(ec queryplanner.ExecutionContext) error {
 				fmt.Println("GovDatabaseProvider being executed for field Name")
-				doc, ok := ec.Payload.Documents[i].(*Person) // Cast to a pointer so we can change the underlying struct
-				if !ok {
-					return fmt.Errorf("error casting document to person struct")
+				personalInfos, err := p.getPersonalInfos(ec) // Note that the CPF is needed to query the gov database.
+				if err != nil {
+					return err
 				}
-				personalInfo, err := p.getPersonalInfo(*doc.CPF, ec) // Note that the CPF is needed to query the gov database.
-				if err == nil {
-					doc.Name = &personalInfo.Name
+				for _, index := range ec.DocumentIndexes() {
+					doc, ok := ec.Payload.Documents[index].(*Person) // Cast to a pointer so we can change the underlying struct
+					if !ok {
+						return fmt.Errorf("error casting document to person struct")
+					}
+					if personalInfo, ok := personalInfos[*doc.CPF]; ok {
+						doc.Name = &personalInfo.Name
+					}
 				}
 				return nil
 			},
@@ -55,15 +62,18 @@ func (p *GovDatabaseProvider) Provides() []queryplanner.Field {
 		},
 		{
 			Name: "Sex",
-			Fill: func(i int, ec queryplanner.ExecutionContext) error {
+			BatchFill: func(ec queryplanner.ExecutionContext) error {
 				fmt.Println("GovDatabaseProvider being executed for field Sex")
-				doc, ok := ec.Payload.Documents[i].(*Person)
-				if !ok {
-					return fmt.Errorf("error casting document to person struct")
+				personalInfos, err := p.getPersonalInfos(ec)
+				if err != nil {
+					return err
 				}
-				personalInfo, err := p.getPersonalInfo(*doc.CPF, ec)
-				if err == nil {
-					switch personalInfo.Sex {
+				for _, index := range ec.DocumentIndexes() {
+					doc, ok := ec.Payload.Documents[index].(*Person)
+					if !ok {
+						return fmt.Errorf("error casting document to person struct")
+					}
+					switch personalInfos[*doc.CPF].Sex {
 					case "Male":
 						doc.Sex = ref("M")
 					case "Female":
@@ -81,23 +91,32 @@ func (p *GovDatabaseProvider) Provides() []queryplanner.Field {
 	}
 }
 
-func (p *GovDatabaseProvider) getPersonalInfo(cpf string, ctx queryplanner.ExecutionContext) (PersonalInfo, error) {
-	res, err := ctx.Cache().GetOrLoad(GovProviderKey(cpf), func() (interface{}, error) {
+// getPersonalInfos queries the personal info of all the documents at once. The cache
+// makes sure the database is hit only once, no matter how many fields are requested,
+// so it loads every document, not only the DocumentIndexes of the field being filled.
+func (p *GovDatabaseProvider) getPersonalInfos(ec queryplanner.ExecutionContext) (map[string]PersonalInfo, error) {
+	res, err := ec.Cache().GetOrLoad(govProviderKey{}, func() (interface{}, error) {
 		fmt.Println("GovDatabase hit the database")
-		res, ok := p.govDatabase[cpf]
-		if !ok {
-			return PersonalInfo{}, fmt.Errorf("not found")
+		personalInfos := make(map[string]PersonalInfo, len(ec.Payload.Documents))
+		for _, d := range ec.Payload.Documents {
+			doc, ok := d.(*Person)
+			if !ok {
+				return nil, fmt.Errorf("error casting document to person struct")
+			}
+			if personalInfo, ok := p.govDatabase[*doc.CPF]; ok {
+				personalInfos[*doc.CPF] = personalInfo
+			}
 		}
-		return res, nil
+		return personalInfos, nil
 	})
 	if err != nil {
-		return PersonalInfo{}, err
+		return nil, err
 	}
-	personalInfo, ok := res.(PersonalInfo)
+	personalInfos, ok := res.(map[string]PersonalInfo)
 	if !ok {
-		return PersonalInfo{}, fmt.Errorf("error casting personalInfo")
+		return nil, fmt.Errorf("error casting personalInfos")
 	}
-	return personalInfo, nil
+	return personalInfos, nil
 }
 
 // DependsOn informs the library which information is needed before the provider can be executed. The names must match the ones defined in other providers.
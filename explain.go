@@ -0,0 +1,187 @@
+package queryplanner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// IndexSource is the FieldExplanation.Source of fields fetched from the
+// IndexProvider.
+const IndexSource = "index"
+
+// DisabledSource is the FieldExplanation.Source of fields whose providers are
+// all disabled for the request. See ConditionalFieldProvider.
+const DisabledSource = "disabled"
+
+// Explanation describes how a Plan resolves a Request: which fields are
+// fetched from the index, which providers are executed and why each field
+// was activated.
+type Explanation struct {
+	// IndexFields are the fields requested from IndexProvider.Execute.
+	IndexFields []FieldName
+	// Providers are the executions of the activated providers, in execution
+	// order. A provider is executed more than once if its fields are split
+	// into steps. See Field.DependsOn.
+	Providers []ProviderExplanation
+	// Fields are all the activated fields, in activation order.
+	Fields []FieldExplanation
+}
+
+// ProviderExplanation describes an activated FieldProvider.
+type ProviderExplanation struct {
+	// Name is the provider's name. See NamedFieldProvider.
+	Name string
+	// Fields are the fields filled by the execution of the provider. Fields
+	// of the provider that are neither requested nor depended upon are not
+	// filled.
+	Fields []FieldName
+	// DependsOn are the dependencies of the fields filled by the provider,
+	// including the activated optional dependencies and the dependencies of
+	// the fallbacks of its fields.
+	DependsOn []FieldName
+}
+
+// FieldExplanation describes why a field was activated.
+type FieldExplanation struct {
+	Name FieldName
+	// Source is the name of the provider filling the field, IndexSource or
+	// DisabledSource.
+	Source string
+	// Fallbacks are the names of the providers that fill the field, in
+	// priority order, in the documents Source could not fill.
+	Fallbacks []string
+	// Requested tells if the field was explicitly requested.
+	Requested bool
+	// RequiredBy are the fields that depend on this one.
+	RequiredBy []FieldName
+	// Chain is the path of DependsOn edges that first pulled the field in,
+	// starting from a requested field and ending with the field itself.
+	Chain []FieldName
+}
+
+// Explain returns the resolved execution plan without executing it.
+func (p plan) Explain() Explanation {
+	indexFields := p.fieldsToBeFetchedFromIndex.ToStrings()
+	sort.Strings(indexFields)
+
+	explanation := Explanation{
+		IndexFields: toFieldNames(indexFields),
+		Providers:   make([]ProviderExplanation, 0, len(p.providers)),
+		Fields:      make([]FieldExplanation, 0, len(p.activationOrder)),
+	}
+
+	for _, step := range p.steps {
+		explanation.Providers = append(explanation.Providers, ProviderExplanation{
+			Name:      providerName(step.provider),
+			Fields:    getFieldNames(step.fields),
+			DependsOn: getProviderDependencies(step.provider, step.fields, p.getActiveFieldDependencies),
+		})
+	}
+
+	for _, field := range p.activationOrder {
+		explanation.Fields = append(explanation.Fields, FieldExplanation{
+			Name:       field,
+			Source:     p.getFieldSource(field),
+			Fallbacks:  p.getFieldFallbacks(field),
+			Requested:  p.isFieldRequested(field),
+			RequiredBy: p.requiredBy[field],
+			Chain:      p.getActivationChain(field),
+		})
+	}
+
+	return explanation
+}
+
+func (p plan) getFieldSource(field FieldName) string {
+	if p.disabledFields.Exists(field) {
+		return DisabledSource
+	}
+	provider, ok := p.fieldProviders[field]
+	if !ok {
+		return IndexSource
+	}
+	return providerName(provider)
+}
+
+func (p plan) getFieldFallbacks(field FieldName) []string {
+	fallbacks := p.fieldFallbacks[field]
+	if len(fallbacks) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(fallbacks))
+	for _, fallback := range fallbacks {
+		names = append(names, providerName(fallback.provider))
+	}
+	return names
+}
+
+func (p plan) getActivationChain(field FieldName) []FieldName {
+	chain := []FieldName{field}
+	for !p.isFieldRequested(field) {
+		parent := p.activatedBy[field]
+		if parent == "" {
+			break
+		}
+		chain = append(chain, parent)
+		field = parent
+	}
+
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain
+}
+
+// String returns a human readable representation of the explanation.
+func (e Explanation) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "index fields: %s\n", joinFieldNames(e.IndexFields, ", "))
+
+	b.WriteString("providers:\n")
+	for i, provider := range e.Providers {
+		fmt.Fprintf(
+			&b, "  %d. %s provides [%s] depends on [%s]\n",
+			i+1, provider.Name,
+			joinFieldNames(provider.Fields, ", "),
+			joinFieldNames(provider.DependsOn, ", "),
+		)
+	}
+
+	b.WriteString("fields:\n")
+	for _, field := range e.Fields {
+		reason := "requested"
+		if !field.Requested {
+			reason = "required by " + joinFieldNames(field.Chain, " -> ")
+		}
+		source := strings.Join(append([]string{field.Source}, field.Fallbacks...), " then ")
+		fmt.Fprintf(&b, "  %s from %s (%s)\n", field.Name, source, reason)
+	}
+
+	return b.String()
+}
+
+func getFieldNames(fields []Field) []FieldName {
+	names := make([]FieldName, 0, len(fields))
+	for _, field := range fields {
+		names = append(names, field.Name)
+	}
+	return names
+}
+
+func toFieldNames(fields []string) []FieldName {
+	names := make([]FieldName, 0, len(fields))
+	for _, field := range fields {
+		names = append(names, FieldName(field))
+	}
+	return names
+}
+
+func joinFieldNames(fields []FieldName, sep string) string {
+	names := make([]string, 0, len(fields))
+	for _, field := range fields {
+		names = append(names, string(field))
+	}
+	return strings.Join(names, sep)
+}
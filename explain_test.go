@@ -0,0 +1,97 @@
+package queryplanner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan_Explain(t *testing.T) {
+	t.Parallel()
+
+	providers := []*fieldProviderMock{
+		{
+			name:      "a-provider",
+			dependsOn: []FieldName{"b"},
+			provides:  []Field{newNoopField("a")},
+		},
+		{
+			name:      "b-provider",
+			dependsOn: []FieldName{"c", "_d"},
+			provides:  []Field{newNoopField("b"), newNoopField("x")},
+		},
+		{
+			name:      "unused-provider",
+			dependsOn: []FieldName{"c"},
+			provides:  []Field{newNoopField("y")},
+		},
+	}
+	indexProvider := &indexProviderMock{
+		provides: []Index{newNoopIndex("c"), newNoopIndex("d"), newNoopIndex("f")},
+	}
+
+	planner, err := NewQueryPlanner(indexProvider, wrapProviders(providers)...)
+	require.NoError(t, err)
+
+	explanation := planner.NewPlan(&requestMock{[]string{"a", "f", "c"}}).Explain()
+
+	assert.Equal(t, []FieldName{"c", "d", "f"}, explanation.IndexFields)
+	assert.Equal(t, []ProviderExplanation{
+		{Name: "b-provider", Fields: []FieldName{"b"}, DependsOn: []FieldName{"c", "_d"}},
+		{Name: "a-provider", Fields: []FieldName{"a"}, DependsOn: []FieldName{"b"}},
+	}, explanation.Providers)
+	assert.Equal(t, []FieldExplanation{
+		{Name: "a", Source: "a-provider", Requested: true, Chain: []FieldName{"a"}},
+		{Name: "b", Source: "b-provider", RequiredBy: []FieldName{"a"}, Chain: []FieldName{"a", "b"}},
+		{Name: "c", Source: IndexSource, Requested: true, RequiredBy: []FieldName{"b"}, Chain: []FieldName{"c"}},
+		{Name: "_d", Source: IndexSource, RequiredBy: []FieldName{"b"}, Chain: []FieldName{"a", "b", "_d"}},
+		{Name: "f", Source: IndexSource, Requested: true, Chain: []FieldName{"f"}},
+	}, explanation.Fields)
+
+	expectedString := `index fields: c, d, f
+providers:
+  1. b-provider provides [b] depends on [c, _d]
+  2. a-provider provides [a] depends on [b]
+fields:
+  a from a-provider (requested)
+  b from b-provider (required by a -> b)
+  c from index (requested)
+  _d from index (required by a -> b -> _d)
+  f from index (requested)
+`
+	assert.Equal(t, expectedString, explanation.String())
+}
+
+func TestPlan_Explain_Fallbacks(t *testing.T) {
+	t.Parallel()
+
+	providers := []FieldProvider{
+		&prioritizedFieldProviderMock{
+			fieldProviderMock: fieldProviderMock{name: "replica", dependsOn: []FieldName{"b"}, provides: []Field{newNoopField("a")}},
+			priority:          1,
+		},
+		&fieldProviderMock{name: "gov", dependsOn: []FieldName{"c"}, provides: []Field{newNoopField("a")}},
+		&fieldProviderMock{name: "b-provider", provides: []Field{newNoopField("b")}},
+	}
+	indexProvider := &indexProviderMock{
+		provides: []Index{newNoopIndex("c")},
+	}
+
+	planner, err := NewQueryPlanner(indexProvider, providers...)
+	require.NoError(t, err)
+
+	explanation := planner.NewPlan(&requestMock{[]string{"a"}}).Explain()
+
+	expectedString := `index fields: c
+providers:
+  1. b-provider provides [b] depends on []
+  2. gov provides [a] depends on [c, b]
+fields:
+  a from gov then replica (requested)
+  c from index (required by a -> c)
+  b from b-provider (required by a -> b)
+`
+	assert.Equal(t, expectedString, explanation.String())
+	assert.Equal(t, []string{"replica"}, explanation.Fields[0].Fallbacks)
+}
@@ -0,0 +1,241 @@
+package queryplanner
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GraphNodeKind tells what a GraphNode represents.
+type GraphNodeKind int
+
+const (
+	// GraphNodeIndex is a field provided by the IndexProvider.
+	GraphNodeIndex GraphNodeKind = iota + 1
+	// GraphNodeRawIndex is a `_` prefixed dependency that is always fetched
+	// from the IndexProvider, even if a FieldProvider overwrites it.
+	GraphNodeRawIndex
+	// GraphNodeProvider is a FieldProvider.
+	GraphNodeProvider
+	// GraphNodeField is a field provided by a FieldProvider.
+	GraphNodeField
+)
+
+// GraphNode is a node of the dependency Graph.
+type GraphNode struct {
+	ID    string
+	Label string
+	Kind  GraphNodeKind
+}
+
+// GraphEdge is a directed edge of the dependency Graph. Edges go from
+// providers to the fields they provide and from fields to the providers
+// that depend on them. Optional edges come from optional dependencies.
+type GraphEdge struct {
+	From     string
+	To       string
+	Optional bool
+}
+
+// Graph is the field/provider dependency graph of a QueryPlanner.
+type Graph struct {
+	Nodes []GraphNode
+	Edges []GraphEdge
+}
+
+// DependencyGraph returns the dependency graph of the planner. If @request
+// is not nil, only the subgraph activated by it is returned.
+func (q *queryPlanner) DependencyGraph(request Request) Graph {
+	builder := newGraphBuilder(q.providers)
+
+	if request == nil {
+		for _, index := range q.indexProvider.Provides() {
+			builder.addNode(GraphNode{ID: indexNodeID(index.Name), Label: string(index.Name), Kind: GraphNodeIndex})
+		}
+		for _, provider := range q.providers {
+			builder.addProvider(provider, provider.Provides(), getFieldOptionalDependencies, q.fieldToProviderMap)
+		}
+		return builder.graph
+	}
+
+	p := q.newPlan(request)
+	for _, field := range p.activationOrder {
+		if _, isProvided := p.fieldProviders[field]; !isProvided {
+			builder.addDependency(field, q.fieldToProviderMap)
+		}
+	}
+	for _, provider := range p.providers {
+		builder.addProvider(provider, p.getNeededFields(provider), p.getActiveFieldOptionalDependencies, q.fieldToProviderMap)
+	}
+	for _, field := range p.activationOrder {
+		for _, fallback := range p.fieldFallbacks[field] {
+			builder.addProvider(fallback.provider, []Field{fallback.field}, p.getActiveFieldOptionalDependencies, q.fieldToProviderMap)
+		}
+	}
+	return builder.graph
+}
+
+// DOT renders the graph using the Graphviz DOT language.
+func (g Graph) DOT() string {
+	var b strings.Builder
+
+	b.WriteString("digraph queryplanner {\n")
+	b.WriteString("  rankdir=LR;\n")
+	for _, node := range g.Nodes {
+		fmt.Fprintf(&b, "  %s [label=%s%s];\n", dotQuote(node.ID), dotQuote(node.Label), dotNodeStyle(node.Kind))
+	}
+	for _, edge := range g.Edges {
+		style := ""
+		if edge.Optional {
+			style = " [style=dashed]"
+		}
+		fmt.Fprintf(&b, "  %s -> %s%s;\n", dotQuote(edge.From), dotQuote(edge.To), style)
+	}
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+// Mermaid renders the graph as a Mermaid flowchart.
+func (g Graph) Mermaid() string {
+	var b strings.Builder
+
+	ids := make(map[string]string, len(g.Nodes))
+	b.WriteString("flowchart LR\n")
+	for i, node := range g.Nodes {
+		id := fmt.Sprintf("n%d", i)
+		ids[node.ID] = id
+		fmt.Fprintf(&b, "  %s%s\n", id, mermaidNodeShape(node))
+	}
+	for _, edge := range g.Edges {
+		arrow := "-->"
+		if edge.Optional {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(&b, "  %s %s %s\n", ids[edge.From], arrow, ids[edge.To])
+	}
+	b.WriteString("  classDef raw fill:#f96,stroke:#c60\n")
+
+	return b.String()
+}
+
+type graphBuilder struct {
+	graph Graph
+	nodes map[string]struct{}
+	// edges maps the endpoints of each edge to its position in the graph.
+	edges map[GraphEdge]int
+	// providerIDs maps each provider to its node ID, which is built from its
+	// position, since providers of the same type have the same name.
+	providerIDs map[FieldProvider]string
+}
+
+func newGraphBuilder(providers []FieldProvider) *graphBuilder {
+	providerIDs := make(map[FieldProvider]string, len(providers))
+	for i, provider := range providers {
+		providerIDs[provider] = fmt.Sprintf("provider:%d", i)
+	}
+	return &graphBuilder{
+		nodes:       make(map[string]struct{}),
+		edges:       make(map[GraphEdge]int),
+		providerIDs: providerIDs,
+	}
+}
+
+func (b *graphBuilder) addNode(node GraphNode) {
+	if _, ok := b.nodes[node.ID]; ok {
+		return
+	}
+	b.nodes[node.ID] = struct{}{}
+	b.graph.Nodes = append(b.graph.Nodes, node)
+}
+
+// addEdge adds an edge from @from to @to. A required edge replaces an
+// optional one between the same nodes.
+func (b *graphBuilder) addEdge(from, to string, optional bool) {
+	edge := GraphEdge{From: from, To: to}
+	if position, ok := b.edges[edge]; ok {
+		b.graph.Edges[position].Optional = b.graph.Edges[position].Optional && optional
+		return
+	}
+	b.edges[edge] = len(b.graph.Edges)
+	edge.Optional = optional
+	b.graph.Edges = append(b.graph.Edges, edge)
+}
+
+// addProvider adds @provider, its @fields and their dependencies. The
+// optional dependencies are those returned by @getOptionalDependencies.
+func (b *graphBuilder) addProvider(
+	provider FieldProvider,
+	fields []Field,
+	getOptionalDependencies func(FieldProvider, Field) []FieldName,
+	fieldToProviderMap fieldProviderByName,
+) {
+	providerID := b.providerIDs[provider]
+	b.addNode(GraphNode{ID: providerID, Label: providerName(provider), Kind: GraphNodeProvider})
+
+	for _, dependency := range getProviderDependencies(provider, fields, getFieldDependencies) {
+		b.addEdge(b.addDependency(dependency, fieldToProviderMap), providerID, false)
+	}
+	for _, dependency := range getProviderDependencies(provider, fields, getOptionalDependencies) {
+		b.addEdge(b.addDependency(dependency, fieldToProviderMap), providerID, true)
+	}
+	for _, field := range fields {
+		b.addNode(GraphNode{ID: fieldNodeID(field.Name), Label: string(field.Name), Kind: GraphNodeField})
+		b.addEdge(providerID, fieldNodeID(field.Name), false)
+	}
+}
+
+// addDependency adds the node that satisfies the @dependency and returns
+// its ID.
+func (b *graphBuilder) addDependency(dependency FieldName, fieldToProviderMap fieldProviderByName) string {
+	if strings.HasPrefix(string(dependency), "_") {
+		id := "raw:" + string(dependency)
+		b.addNode(GraphNode{ID: id, Label: string(dependency), Kind: GraphNodeRawIndex})
+		return id
+	}
+	dependency = fieldToProviderMap.Resolve(dependency)
+	if _, isProvided := fieldToProviderMap.GetByName(dependency); isProvided {
+		b.addNode(GraphNode{ID: fieldNodeID(dependency), Label: string(dependency), Kind: GraphNodeField})
+		return fieldNodeID(dependency)
+	}
+	b.addNode(GraphNode{ID: indexNodeID(dependency), Label: string(dependency), Kind: GraphNodeIndex})
+	return indexNodeID(dependency)
+}
+
+func indexNodeID(field FieldName) string {
+	return "index:" + string(field)
+}
+
+func fieldNodeID(field FieldName) string {
+	return "field:" + string(field)
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+func dotNodeStyle(kind GraphNodeKind) string {
+	switch kind {
+	case GraphNodeIndex:
+		return ", shape=cylinder"
+	case GraphNodeRawIndex:
+		return `, shape=cylinder, style=filled, fillcolor="#ff9966"`
+	case GraphNodeProvider:
+		return ", shape=box"
+	default:
+		return ", shape=ellipse"
+	}
+}
+
+func mermaidNodeShape(node GraphNode) string {
+	label := `"` + strings.ReplaceAll(node.Label, `"`, "#quot;") + `"`
+	switch node.Kind {
+	case GraphNodeIndex:
+		return "[(" + label + ")]"
+	case GraphNodeRawIndex:
+		return "[(" + label + ")]:::raw"
+	case GraphNodeProvider:
+		return "[" + label + "]"
+	default:
+		return "([" + label + "])"
+	}
+}
@@ -0,0 +1,141 @@
+package queryplanner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryPlanner_DependencyGraph(t *testing.T) {
+	t.Parallel()
+
+	providers := []*fieldProviderMock{
+		{
+			name:      "formatter",
+			dependsOn: []FieldName{"_cpf"},
+			provides:  []Field{newNoopField("cpf")},
+		},
+		{
+			name:      "gov",
+			dependsOn: []FieldName{"cpf"},
+			provides:  []Field{newNoopField("name"), newNoopField("sex")},
+		},
+		{
+			name:      "covid",
+			dependsOn: []FieldName{"cpf", "date"},
+			provides:  []Field{newNoopField("had_covid")},
+		},
+	}
+	indexProvider := &indexProviderMock{
+		provides: []Index{newNoopIndex("cpf"), newNoopIndex("date")},
+	}
+
+	planner, err := NewQueryPlanner(indexProvider, wrapProviders(providers)...)
+	require.NoError(t, err)
+
+	t.Run("DOT", func(t *testing.T) {
+		t.Parallel()
+
+		expected := `digraph queryplanner {
+  rankdir=LR;
+  "index:cpf" [label="cpf", shape=cylinder];
+  "index:date" [label="date", shape=cylinder];
+  "provider:0" [label="formatter", shape=box];
+  "raw:_cpf" [label="_cpf", shape=cylinder, style=filled, fillcolor="#ff9966"];
+  "field:cpf" [label="cpf", shape=ellipse];
+  "provider:1" [label="gov", shape=box];
+  "field:name" [label="name", shape=ellipse];
+  "field:sex" [label="sex", shape=ellipse];
+  "provider:2" [label="covid", shape=box];
+  "field:had_covid" [label="had_covid", shape=ellipse];
+  "raw:_cpf" -> "provider:0";
+  "provider:0" -> "field:cpf";
+  "field:cpf" -> "provider:1";
+  "provider:1" -> "field:name";
+  "provider:1" -> "field:sex";
+  "field:cpf" -> "provider:2";
+  "index:date" -> "provider:2";
+  "provider:2" -> "field:had_covid";
+}
+`
+		assert.Equal(t, expected, planner.DependencyGraph(nil).DOT())
+	})
+
+	t.Run("Mermaid", func(t *testing.T) {
+		t.Parallel()
+
+		expected := `flowchart LR
+  n0[("_cpf")]:::raw
+  n1["formatter"]
+  n2(["cpf"])
+  n3["gov"]
+  n4(["name"])
+  n0 --> n1
+  n1 --> n2
+  n2 --> n3
+  n3 --> n4
+  classDef raw fill:#f96,stroke:#c60
+`
+		graph := planner.DependencyGraph(&requestMock{[]string{"name"}})
+		assert.Equal(t, expected, graph.Mermaid())
+	})
+}
+
+func TestQueryPlanner_DependencyGraph_OptionalDependencies(t *testing.T) {
+	t.Parallel()
+
+	summary := newNoopField("summary")
+	summary.OptionalDependsOn = []FieldName{"date", "name"}
+	providers := []*fieldProviderMock{
+		{name: "summarizer", dependsOn: []FieldName{"cpf"}, provides: []Field{summary}},
+		{name: "gov", provides: []Field{newNoopField("name")}},
+	}
+	indexProvider := &indexProviderMock{
+		provides: []Index{newNoopIndex("cpf"), newNoopIndex("date")},
+	}
+
+	planner, err := NewQueryPlanner(indexProvider, wrapProviders(providers)...)
+	require.NoError(t, err)
+
+	expected := `flowchart LR
+  n0[("cpf")]
+  n1[("date")]
+  n2["summarizer"]
+  n3(["summary"])
+  n0 --> n2
+  n1 -.-> n2
+  n2 --> n3
+  classDef raw fill:#f96,stroke:#c60
+`
+	graph := planner.DependencyGraph(&requestMock{[]string{"summary"}})
+	assert.Equal(t, expected, graph.Mermaid())
+	assert.Contains(t, planner.DependencyGraph(nil).DOT(), `"field:name" -> "provider:0" [style=dashed];`)
+}
+
+func TestQueryPlanner_DependencyGraph_SameProviderName(t *testing.T) {
+	t.Parallel()
+
+	providers := []*fieldProviderMock{
+		{name: "gov", dependsOn: []FieldName{"cpf"}, provides: []Field{newNoopField("name")}},
+		{name: "gov", dependsOn: []FieldName{"cpf"}, provides: []Field{newNoopField("sex")}},
+	}
+	indexProvider := &indexProviderMock{provides: []Index{newNoopIndex("cpf")}}
+
+	planner, err := NewQueryPlanner(indexProvider, wrapProviders(providers)...)
+	require.NoError(t, err)
+
+	expected := `flowchart LR
+  n0[("cpf")]
+  n1["gov"]
+  n2(["name"])
+  n3["gov"]
+  n4(["sex"])
+  n0 --> n1
+  n1 --> n2
+  n0 --> n3
+  n3 --> n4
+  classDef raw fill:#f96,stroke:#c60
+`
+	assert.Equal(t, expected, planner.DependencyGraph(nil).Mermaid())
+}
@@ -0,0 +1,95 @@
+package queryplanner
+
+import (
+	"strings"
+
+	"github.com/arquivei/foundationkit/errors"
+)
+
+// MapDocument is a document whose fields are the keys of a map. See
+// WithMapDocuments.
+type MapDocument = map[string]interface{}
+
+// mapDocumentAdapter maps each field name to a key of a MapDocument. Dotted
+// field names are paths of nested MapDocuments. Documents that are not
+// MapDocuments are ignored.
+type mapDocumentAdapter struct{}
+
+func (mapDocumentAdapter) checkField(field FieldName) error {
+	const op = errors.Op("mapDocumentAdapter.checkField")
+	for _, key := range strings.Split(string(field), fieldPathSeparator) {
+		if key == "" {
+			return errors.E(op, "field name is not a valid map path", errors.KV("fieldName", field))
+		}
+	}
+	return nil
+}
+
+// clear deletes the key of @field and the nested documents it leaves empty.
+func (mapDocumentAdapter) clear(field FieldName, document Document) {
+	m, ok := document.(MapDocument)
+	if !ok {
+		return
+	}
+	clearMapPath(m, strings.Split(string(field), fieldPathSeparator))
+}
+
+func clearMapPath(m MapDocument, path []string) {
+	if len(path) == 1 {
+		delete(m, path[0])
+		return
+	}
+	nested, ok := m[path[0]].(MapDocument)
+	if !ok {
+		return
+	}
+	clearMapPath(nested, path[1:])
+	if len(nested) == 0 {
+		delete(m, path[0])
+	}
+}
+
+func (mapDocumentAdapter) get(field FieldName, document Document) (interface{}, bool) {
+	m, ok := document.(MapDocument)
+	if !ok {
+		return nil, false
+	}
+	path := strings.Split(string(field), fieldPathSeparator)
+	for _, key := range path[:len(path)-1] {
+		m, ok = m[key].(MapDocument)
+		if !ok {
+			return nil, false
+		}
+	}
+	value, ok := m[path[len(path)-1]]
+	return value, ok
+}
+
+// canGet is always true, since unset fields have no key.
+func (mapDocumentAdapter) canGet(FieldName) bool {
+	return true
+}
+
+// set sets the key of @field, creating the missing nested documents. The
+// value is not set if a key of the path holds something other than a
+// MapDocument.
+func (mapDocumentAdapter) set(field FieldName, document Document, value interface{}) error {
+	m, ok := document.(MapDocument)
+	if !ok {
+		return nil
+	}
+	path := strings.Split(string(field), fieldPathSeparator)
+	for _, key := range path[:len(path)-1] {
+		nested, exists := m[key]
+		if !exists {
+			nested = make(MapDocument)
+			m[key] = nested
+		}
+		m, ok = nested.(MapDocument)
+		if !ok {
+			return nil
+		}
+	}
+	m[path[len(path)-1]] = value
+	return nil
+}
@@ -0,0 +1,170 @@
+package queryplanner
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapDocumentAdapter(t *testing.T) {
+	t.Parallel()
+
+	adapter := mapDocumentAdapter{}
+	document := MapDocument{"cpf": "1", "address": MapDocument{"city": "Rio"}}
+
+	value, found := adapter.get("address.city", document)
+	assert.True(t, found)
+	assert.Equal(t, "Rio", value)
+
+	_, found = adapter.get("address.state", document)
+	assert.False(t, found)
+	_, found = adapter.get("cpf.number", document)
+	assert.False(t, found)
+	_, found = adapter.get("cpf", &document)
+	assert.False(t, found)
+
+	adapter.set("address.state", document, "RJ")
+	adapter.set("job.company.name", document, "Arquivei")
+	adapter.set("cpf.number", document, "2")
+	assert.Equal(t, MapDocument{
+		"cpf":     "1",
+		"address": MapDocument{"city": "Rio", "state": "RJ"},
+		"job":     MapDocument{"company": MapDocument{"name": "Arquivei"}},
+	}, document)
+
+	adapter.clear("address.city", document)
+	adapter.clear("job.company.name", document)
+	adapter.clear("cpf.number", document)
+	adapter.clear("missing.key", document)
+	assert.Equal(t, MapDocument{"cpf": "1", "address": MapDocument{"state": "RJ"}}, document)
+
+	assert.NoError(t, adapter.checkField("address.city"))
+	assert.EqualError(t, adapter.checkField("address..city"), "mapDocumentAdapter.checkField: field name is not a valid map path [fieldName=address..city]")
+}
+
+func TestQueryPlanner_MapDocuments(t *testing.T) {
+	t.Parallel()
+
+	fillValue := func(int, ExecutionContext) (interface{}, error) { return "value", nil }
+
+	tests := []struct {
+		name        string
+		provides    []Field
+		options     []Option
+		expectedErr string
+	}{
+		{
+			name:     "success",
+			provides: []Field{{Name: "name", FillValue: fillValue}, {Name: "address.city", Fill: func(int, ExecutionContext) error { return nil }}},
+			options:  []Option{WithMapDocuments()},
+		},
+		{
+			name:        "invalid path",
+			provides:    []Field{{Name: "address.", FillValue: fillValue}},
+			options:     []Option{WithMapDocuments()},
+			expectedErr: "queryplanner.NewQueryPlannerWithOptions: checkIfFieldProvidersAreDeclaredCorrectly: checkMethodsFromFieldProvider: mapDocumentAdapter.checkField: field name is not a valid map path [fieldName=address.]",
+		},
+		{
+			name:        "fill value without set",
+			provides:    []Field{{Name: "name", FillValue: fillValue, Clear: func(Document) {}}},
+			expectedErr: "queryplanner.NewQueryPlannerWithOptions: checkIfFieldProvidersAreDeclaredCorrectly: checkMethodsFromFieldProvider: field filled by `fillValue' has no `set' method [fieldName=name]",
+		},
+		{
+			name:        "fill value and fill",
+			provides:    []Field{{Name: "name", FillValue: fillValue, Fill: func(int, ExecutionContext) error { return nil }}},
+			options:     []Option{WithMapDocuments()},
+			expectedErr: "queryplanner.NewQueryPlannerWithOptions: checkIfFieldProvidersAreDeclaredCorrectly: checkMethodsFromFieldProvider: field has both `fillValue' and `fill' or `batchFill' methods [fieldName=name]",
+		},
+		{
+			name:        "tagged and map documents",
+			provides:    []Field{{Name: "name", FillValue: fillValue}},
+			options:     []Option{WithMapDocuments(), WithTaggedDocument((*taggedPerson)(nil))},
+			expectedErr: "queryplanner.NewQueryPlannerWithOptions: newDocumentAdapter: tagged documents and map documents are mutually exclusive",
+		},
+		{
+			name:        "map documents and concurrent providers",
+			provides:    []Field{{Name: "name", FillValue: fillValue}},
+			options:     []Option{WithMapDocuments(), WithMaxParallelism(0)},
+			expectedErr: "queryplanner.NewQueryPlannerWithOptions: newDocumentAdapter: map documents cannot be filled by concurrent providers [maxParallelism=0]",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewQueryPlannerWithOptions(
+				&indexProviderMock{provides: []Index{{Name: "cpf", Clear: func(Document) {}}}},
+				[]FieldProvider{&fieldProviderMock{name: "gov", dependsOn: []FieldName{"cpf"}, provides: test.provides}},
+				test.options...,
+			)
+			if test.expectedErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, test.expectedErr)
+		})
+	}
+}
+
+func TestPlanExecution_MapDocuments(t *testing.T) {
+	t.Parallel()
+
+	names := map[interface{}]interface{}{"1": "Maria"}
+	providers := []FieldProvider{
+		&fieldProviderMock{
+			name:      "gov",
+			dependsOn: []FieldName{"cpf"},
+			provides: []Field{
+				{
+					Name: "name",
+					FillValue: func(index int, ec ExecutionContext) (interface{}, error) {
+						return names[ec.Payload.Documents[index].(MapDocument)["cpf"]], nil
+					},
+				},
+				{
+					Name: "address.city",
+					FillValue: func(index int, ec ExecutionContext) (interface{}, error) {
+						if index == 2 {
+							return nil, errors.New("gov is down")
+						}
+						return "Rio", nil
+					},
+				},
+			},
+		},
+		&prioritizedFieldProviderMock{
+			fieldProviderMock: fieldProviderMock{
+				name:     "registry",
+				provides: []Field{{Name: "name", FillValue: func(int, ExecutionContext) (interface{}, error) { return "Unknown", nil }}},
+			},
+			priority: 1,
+		},
+	}
+	indexProvider := &indexProviderMock{
+		provides: []Index{{Name: "cpf"}, {Name: "address.state"}},
+		execute: func(*indexProviderMock, context.Context, Request, []string) (*Payload, error) {
+			return &Payload{Documents: []Document{
+				MapDocument{"cpf": "1", "address": MapDocument{"state": "RJ"}},
+				MapDocument{"cpf": "2", "address": MapDocument{"state": "SP"}},
+				MapDocument{"cpf": "3"},
+			}}, nil
+		},
+	}
+
+	planner, err := NewQueryPlannerWithOptions(indexProvider, providers, WithMapDocuments(), WithPartialResults())
+	require.NoError(t, err)
+
+	payload, err := planner.NewPlan(&requestMock{[]string{"name", "address.city"}}).Execute(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Document{
+		MapDocument{"name": "Maria", "address": MapDocument{"city": "Rio"}},
+		MapDocument{"name": "Unknown", "address": MapDocument{"city": "Rio"}},
+		MapDocument{"name": "Unknown"},
+	}, payload.Documents)
+	assert.Equal(t, []FieldError{
+		{DocumentIndex: 2, Field: "address.city", Err: errors.New("gov is down")},
+	}, payload.Errors)
+}
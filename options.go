@@ -0,0 +1,131 @@
+package queryplanner
+
+// Option configures a QueryPlanner created by NewQueryPlannerWithOptions.
+type Option func(*config)
+
+type config struct {
+	maxParallelism      int
+	entityCache         *EntityCache
+	partialResults      bool
+	costBasedSelection  bool
+	disabledFieldPolicy DisabledFieldPolicy
+
+	// taggedDocumentSample and mapDocuments are set by WithTaggedDocument
+	// and WithMapDocuments. The documentAdapter is derived from them when
+	// the planner is created.
+	taggedDocumentSample Document
+	mapDocuments         bool
+	documentAdapter      documentAdapter
+}
+
+func newConfig(options []Option) config {
+	c := config{
+		maxParallelism: 1,
+	}
+	for _, option := range options {
+		option(&c)
+	}
+	return c
+}
+
+// WithMaxParallelism sets how many FieldProviders that do not depend on each
+// other may be executed at the same time. The default is 1, meaning that the
+// providers are executed sequentially. A value lower than 1 removes the limit.
+//
+// Providers executed concurrently must not write the same document fields.
+// It cannot be used WithMapDocuments.
+func WithMaxParallelism(n int) Option {
+	return func(c *config) {
+		c.maxParallelism = n
+	}
+}
+
+// WithEntityCache caches the values of fields across requests. Only fields
+// that set Field.Cache are cached.
+func WithEntityCache(cache *EntityCache) Option {
+	return func(c *config) {
+		c.entityCache = cache
+	}
+}
+
+// WithPartialResults makes a Plan return the documents even if some fields
+// could not be filled. Each failure is recorded in Payload.Errors, the field
+// is cleared from the document and the fields depending on it are skipped
+// in that document. A failed child plan fails the child fields in all the
+// parents, see ChildPlanner.
+func WithPartialResults() Option {
+	return func(c *config) {
+		c.partialResults = true
+	}
+}
+
+// WithCostBasedSelection makes a Plan choose, among the providers of each
+// field, the one that adds the lowest cost to the plan, instead of the one
+// with the highest priority. A provider that must be executed anyway for
+// other fields adds no cost. See CostEstimatingFieldProvider.
+//
+// The selected provider is the only one that fills the field, so there are
+// no fallbacks.
+func WithCostBasedSelection() Option {
+	return func(c *config) {
+		c.costBasedSelection = true
+	}
+}
+
+// DisabledFieldPolicy tells how a Plan handles fields whose providers are all
+// disabled for the request. See ConditionalFieldProvider.
+type DisabledFieldPolicy int
+
+const (
+	// LeaveDisabledFieldsEmpty does not fill the disabled fields. The fields
+	// depending on them are filled without them. It is the default.
+	LeaveDisabledFieldsEmpty DisabledFieldPolicy = iota
+	// RejectDisabledFields makes the Plan fail if a disabled field is
+	// requested or depended upon.
+	RejectDisabledFields
+)
+
+// WithDisabledFieldPolicy sets how fields whose providers are all disabled
+// for the request are handled.
+func WithDisabledFieldPolicy(policy DisabledFieldPolicy) Option {
+	return func(c *config) {
+		c.disabledFieldPolicy = policy
+	}
+}
+
+// WithTaggedDocument maps field names to the struct fields of the type of
+// @document tagged with `qp:"<field name>"`, e.g. `qp:"HadCovid"`. The
+// document type must be a pointer to a struct, e.g. (*Person)(nil).
+//
+// Fields and indexes without Clear are cleared by setting their tagged
+// struct field to its zero value. Likewise, fields without Set write their
+// tagged struct field. Fields without Get read their tagged struct field
+// only if it is nillable, e.g. a pointer, whose nil value means that the
+// field is not set. The zero value of the others, e.g. false or 0, cannot
+// be told from an unset field, so they have no Get: they cannot be
+// projected or cached, and their fallbacks only fill the documents the
+// previous providers failed to fill. See Plan.Project. Every field and index
+// must have a tagged struct field, which is validated when the planner is
+// created.
+func WithTaggedDocument(document Document) Option {
+	return func(c *config) {
+		c.taggedDocumentSample = document
+	}
+}
+
+// WithMapDocuments makes the planner handle MapDocuments, whose fields are
+// map keys. A dotted field name, e.g. "address.city", is a path of nested
+// MapDocuments.
+//
+// Fields and indexes without Clear are cleared by deleting their key, and
+// the nested documents left empty. Fields without Get and Set read and write
+// their key, creating the missing nested documents. Fields may be filled by
+// FillValue, whose value is stored under the field name.
+//
+// It cannot be used WithTaggedDocument, nor WithMaxParallelism other than 1,
+// since a map may not be written by concurrent providers.
+func WithMapDocuments() Option {
+	return func(c *config) {
+		c.mapDocuments = true
+	}
+}
@@ -2,6 +2,7 @@ package queryplanner
 
 import (
 	"context"
+	"slices"
 	"sort"
 	"strings"
 
@@ -12,6 +13,8 @@ import (
 // Payload with the enriched Document and CustomData.
 type Plan interface {
 	Execute(context.Context) (*Payload, error)
+	Project(context.Context) (*Projection, error)
+	Explain() Explanation
 }
 
 // plan implements a Plan. It can be executed using an IndexProvider and a
@@ -21,37 +24,110 @@ type plan struct {
 	indexProvider              IndexProvider
 	providers                  []FieldProvider
 	request                    Request
+	config                     config
+
+	// requestedFields are the fields of the request, with the wildcards
+	// expanded.
+	requestedFields []string
+	// fieldArguments are the arguments of the requested fields. See
+	// Field.Arguments.
+	fieldArguments map[FieldName]FieldArguments
+	// fieldOwners are the subtrees that provide the activated nested fields
+	// that are not registered themselves. See Field.Subtree.
+	fieldOwners map[FieldName]FieldName
 
 	processedFields    fieldNameSet
 	processedProviders fieldProviderSet
+
+	// steps are the executions of the providers, in execution order. See
+	// scheduleProviders.
+	steps []providerStep
+
+	// activationOrder, activatedBy and requiredBy record why each field was
+	// activated. They are only used to explain the plan.
+	activationOrder []FieldName
+	activatedBy     map[FieldName]FieldName
+	requiredBy      map[FieldName][]FieldName
+
+	// fieldProviders are the main providers of the activated fields and
+	// fieldFallbacks their fallbacks, in priority order.
+	fieldProviders map[FieldName]FieldProvider
+	fieldFallbacks map[FieldName][]fieldAlternative
+
+	// selectedProviders and deferredActivations are used to select the
+	// providers by cost. See WithCostBasedSelection.
+	selectedProviders   map[FieldName]FieldProvider
+	deferredActivations []deferredActivation
+
+	// enabledProviders caches whether each provider is enabled for the
+	// request and disabledFields are the activated fields whose providers
+	// are all disabled. See ConditionalFieldProvider.
+	enabledProviders map[FieldProvider]bool
+	disabledFields   fieldNameSet
+
+	// err is returned when the plan is executed.
+	err error
+}
+
+// providerStep is a group of needed fields of a provider that are filled
+// together. See plan.scheduleProviders.
+type providerStep struct {
+	provider FieldProvider
+	fields   []Field
+	// dependsOn are the indexes of the steps that must be executed before
+	// this one.
+	dependsOn []int
 }
 
 // Execute runs a Plan and returns the enriched Payload.
 func (p plan) Execute(ctx context.Context) (*Payload, error) {
 	const op = errors.Op("queryplanner.Plan.Execute")
 
-	err := p.checkIfIndexHasTheNecessaryFields()
+	if p.err != nil {
+		return nil, errors.E(op, p.err)
+	}
+
+	payload, err := p.execute(ctx, true)
 	if err != nil {
 		return nil, errors.E(op, err)
 	}
+	return payload, nil
+}
+
+// execute runs the plan. If @clearNonRequestedFields, the fields that were
+// not requested are cleared from the documents.
+func (p plan) execute(ctx context.Context, clearNonRequestedFields bool) (*Payload, error) {
+	err := p.checkIfIndexHasTheNecessaryFields()
+	if err != nil {
+		return nil, err
+	}
 
 	fieldToBeFetchedFromIndex := p.fieldsToBeFetchedFromIndex.ToStrings()
 	sort.Strings(fieldToBeFetchedFromIndex)
 
 	data, err := p.indexProvider.Execute(ctx, p.request, fieldToBeFetchedFromIndex)
 	if err != nil {
-		return nil, errors.E(op, err)
+		return nil, err
+	}
+
+	providerCaches := make(map[FieldProvider]*Cache, len(p.providers))
+	for _, provider := range p.providers {
+		providerCaches[provider] = newCache()
 	}
 
 	execution := planExecution{
-		plan:         &p,
-		data:         data,
-		filledFields: newFieldNameSet(0),
+		plan:                    &p,
+		data:                    data,
+		filledFields:            newFieldNameSet(0),
+		providerCaches:          providerCaches,
+		sharedCache:             newCache(),
+		failedFields:            make(map[FieldName]map[int]struct{}),
+		clearNonRequestedFields: clearNonRequestedFields,
 	}
 
 	err = execution.start(ctx)
 	if err != nil {
-		return nil, errors.E(op, err)
+		return nil, err
 	}
 
 	return execution.data, nil
@@ -71,46 +147,336 @@ func (p plan) checkIfIndexHasTheNecessaryFields() error {
 	if fieldsNotDefinedInIndexProvider.Length() > 0 {
 		fields := fieldsNotDefinedInIndexProvider.ToStrings()
 		sort.Strings(fields)
-		return errors.E(op, "unsupported fields by index", errors.KV("fields", strings.Join(fields, ",")))
+		return errors.E(
+			op,
+			&ErrUnsupportedIndexFields{Fields: toFieldNames(fields)},
+			errors.KV("fields", strings.Join(fields, ",")),
+		)
 	}
 	return nil
 }
 
+// activateField adds @fieldName to the plan. The @parent is the field that
+// depends on it, or empty if the field was requested.
 func (p *plan) activateField(
 	fieldName FieldName,
+	parent FieldName,
 	fieldToProviderMap fieldProviderByName,
 ) {
+	if owner := fieldToProviderMap.Resolve(fieldName); owner != fieldName {
+		p.fieldOwners[fieldName] = owner
+		fieldName = owner
+	}
+	if p.deferActivation(fieldName, parent, fieldToProviderMap) {
+		return
+	}
+	if parent != "" {
+		p.requiredBy[fieldName] = append(p.requiredBy[fieldName], parent)
+	}
 	if p.processedFields.Exists(fieldName) {
 		return
 	}
 	p.processedFields.Add(fieldName)
+	p.activationOrder = append(p.activationOrder, fieldName)
+	p.activatedBy[fieldName] = parent
 
-	provider, providerExists := fieldToProviderMap.GetByName(fieldName)
-	if providerExists {
-		p.activateProvider(provider, fieldToProviderMap)
-	} else {
+	if _, isProvided := fieldToProviderMap.GetByName(fieldName); !isProvided {
 		p.fieldsToBeFetchedFromIndex.Add(transformIntoIndexField(fieldName))
+		return
+	}
+
+	alternatives := p.getEnabledAlternatives(fieldName, fieldToProviderMap)
+	if len(alternatives) == 0 {
+		p.disableField(fieldName)
+		return
+	}
+
+	provider, isSelected := p.selectedProviders[fieldName]
+	if !isSelected {
+		provider = alternatives[0].provider
+		if len(alternatives) > 1 && !p.config.costBasedSelection {
+			p.fieldFallbacks[fieldName] = alternatives[1:]
+		}
+	}
+	p.fieldProviders[fieldName] = provider
+	p.activateProvider(provider, fieldName, fieldToProviderMap)
+}
+
+// getEnabledAlternatives returns the providers of @fieldName that are
+// enabled for the request, in priority order.
+func (p *plan) getEnabledAlternatives(fieldName FieldName, fieldToProviderMap fieldProviderByName) []fieldAlternative {
+	alternatives := fieldToProviderMap.GetAlternativesByName(fieldName)
+	enabled := make([]fieldAlternative, 0, len(alternatives))
+	for _, alternative := range alternatives {
+		isEnabled, ok := p.enabledProviders[alternative.provider]
+		if !ok {
+			isEnabled = isProviderEnabled(alternative.provider, p.request)
+			p.enabledProviders[alternative.provider] = isEnabled
+		}
+		if isEnabled {
+			enabled = append(enabled, alternative)
+		}
+	}
+	return enabled
+}
+
+// disableField handles @fieldName, whose providers are all disabled,
+// according to the DisabledFieldPolicy.
+func (p *plan) disableField(fieldName FieldName) {
+	const op = errors.Op("plan.disableField")
+
+	p.disabledFields.Add(fieldName)
+	if p.config.disabledFieldPolicy == RejectDisabledFields && p.err == nil {
+		p.err = errors.E(op, "field is only provided by disabled providers", errors.KV("field", fieldName))
 	}
 }
 
+// activateProvider activates the dependencies of the field @activatedBy,
+// including those of its fallbacks, and adds its provider to the plan.
 func (p *plan) activateProvider(
 	provider FieldProvider,
+	activatedBy FieldName,
 	fieldToProviderMap fieldProviderByName,
 ) {
+	field, _ := getField(provider, activatedBy)
+	for _, alternative := range p.getFieldAlternatives(provider, field) {
+		for _, dependency := range getFieldDependencies(alternative.provider, alternative.field) {
+			p.activateField(dependency, activatedBy, fieldToProviderMap)
+		}
+	}
+
 	if p.processedProviders.Exists(provider) {
 		return
 	}
+	p.processedProviders.Add(provider)
+	p.providers = append(p.providers, provider)
+}
 
-	for _, field := range provider.DependsOn() {
-		p.activateField(field, fieldToProviderMap)
+// activateOptionalDependencies activates the optional dependencies of the
+// activated fields that are cheap, that is, provided by the IndexProvider.
+// Optional dependencies that are activated anyway need no activation.
+func (p *plan) activateOptionalDependencies(fieldToProviderMap fieldProviderByName) {
+	indexFields := newFieldNameSet(0)
+	for _, index := range p.indexProvider.Provides() {
+		indexFields.Add(index.Name)
 	}
 
-	p.processedProviders.Add(provider)
-	p.providers = append(p.providers, provider)
+	for _, provider := range p.providers {
+		for _, field := range p.getNeededFields(provider) {
+			for _, alternative := range p.getFieldAlternatives(provider, field) {
+				for _, dependency := range getFieldOptionalDependencies(alternative.provider, alternative.field) {
+					owner := fieldToProviderMap.Resolve(dependency)
+					_, isProvided := fieldToProviderMap.GetByName(owner)
+					isCheap := !isProvided && indexFields.Exists(transformIntoIndexField(owner))
+					if isCheap || p.processedFields.Exists(owner) {
+						p.activateField(dependency, field.Name, fieldToProviderMap)
+					}
+				}
+			}
+		}
+	}
+}
+
+// getFieldAlternatives returns @field of its main @provider followed by its
+// fallbacks.
+func (p *plan) getFieldAlternatives(provider FieldProvider, field Field) []fieldAlternative {
+	fallbacks := p.fieldFallbacks[field.Name]
+	alternatives := make([]fieldAlternative, 0, 1+len(fallbacks))
+	alternatives = append(alternatives, fieldAlternative{provider: provider, field: field})
+	return append(alternatives, fallbacks...)
+}
+
+// getActiveFieldDependencies returns the dependencies of @field and its
+// optional dependencies that are activated, including those of its
+// fallbacks, which are executed along with @provider.
+func (p *plan) getActiveFieldDependencies(provider FieldProvider, field Field) []FieldName {
+	active := make([]FieldName, 0)
+	for _, alternative := range p.getFieldAlternatives(provider, field) {
+		active = append(active, getFieldDependencies(alternative.provider, alternative.field)...)
+		active = append(active, p.getActiveFieldOptionalDependencies(alternative.provider, alternative.field)...)
+	}
+	return active
+}
+
+// getActiveFieldOptionalDependencies returns the optional dependencies of
+// @field that are activated.
+func (p *plan) getActiveFieldOptionalDependencies(provider FieldProvider, field Field) []FieldName {
+	active := make([]FieldName, 0)
+	for _, dependency := range getFieldOptionalDependencies(provider, field) {
+		if p.processedFields.Exists(p.resolveField(dependency)) {
+			active = append(active, dependency)
+		}
+	}
+	return active
+}
+
+// scheduleProviders splits the needed fields of each provider of the plan
+// into steps and sorts the steps so that every step comes after the steps
+// it depends on. The fields of a provider are filled in a single step,
+// unless a field depends on another provider that depends on a field of the
+// step, e.g. a provider of x and of y depending on z, and a provider of z
+// depending on x. Then the field goes to a new step of the provider. The
+// providers are sorted by their first step.
+func (p *plan) scheduleProviders() {
+	steps := make([]providerStep, 0, len(p.providers))
+	fieldSteps := make(map[FieldName]int)
+	lastSteps := make(map[FieldProvider]int, len(p.providers))
+
+	var schedule func(provider FieldProvider, field Field)
+	schedule = func(provider FieldProvider, field Field) {
+		if _, ok := fieldSteps[field.Name]; ok {
+			return
+		}
+
+		dependsOn := make([]int, 0)
+		for _, dependency := range p.getActiveFieldDependencies(provider, field) {
+			dependency = p.resolveField(dependency)
+			dependencyProvider, ok := p.fieldProviders[dependency]
+			if !ok {
+				continue
+			}
+			dependencyField, _ := getField(dependencyProvider, dependency)
+			schedule(dependencyProvider, dependencyField)
+			if !slices.Contains(dependsOn, fieldSteps[dependency]) {
+				dependsOn = append(dependsOn, fieldSteps[dependency])
+			}
+		}
+
+		step, ok := lastSteps[provider]
+		isCyclic := func(dependency int) bool {
+			return dependency != step && isStepReachable(steps, dependency, step)
+		}
+		if !ok || slices.ContainsFunc(dependsOn, isCyclic) {
+			step = len(steps)
+			steps = append(steps, providerStep{provider: provider, dependsOn: []int{}})
+			lastSteps[provider] = step
+		}
+		steps[step].fields = append(steps[step].fields, field)
+		for _, dependency := range dependsOn {
+			if dependency != step && !slices.Contains(steps[step].dependsOn, dependency) {
+				steps[step].dependsOn = append(steps[step].dependsOn, dependency)
+			}
+		}
+		fieldSteps[field.Name] = step
+	}
+
+	for _, provider := range p.providers {
+		for _, field := range p.getNeededFields(provider) {
+			schedule(provider, field)
+		}
+	}
+
+	p.steps = sortSteps(steps)
+	providers := make([]FieldProvider, 0, len(p.providers))
+	scheduled := newFieldProviderSet(len(p.providers))
+	for _, step := range p.steps {
+		if !scheduled.Exists(step.provider) {
+			scheduled.Add(step.provider)
+			providers = append(providers, step.provider)
+		}
+	}
+	p.providers = providers
+}
+
+// isStepReachable tells if the step @to is @from or one of the steps it
+// depends on, directly or not.
+func isStepReachable(steps []providerStep, from int, to int) bool {
+	if from == to {
+		return true
+	}
+	for _, dependency := range steps[from].dependsOn {
+		if isStepReachable(steps, dependency, to) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortSteps returns the @steps sorted so that every step comes after the
+// steps it depends on, with their dependencies updated to the new indexes.
+func sortSteps(steps []providerStep) []providerStep {
+	positions := make(map[int]int, len(steps))
+	sorted := make([]providerStep, 0, len(steps))
+
+	var visit func(step int)
+	visit = func(step int) {
+		if _, ok := positions[step]; ok {
+			return
+		}
+		for _, dependency := range steps[step].dependsOn {
+			visit(dependency)
+		}
+		positions[step] = len(sorted)
+		sorted = append(sorted, steps[step])
+	}
+
+	for step := range steps {
+		visit(step)
+	}
+	for position := range sorted {
+		dependsOn := make([]int, 0, len(sorted[position].dependsOn))
+		for _, dependency := range sorted[position].dependsOn {
+			dependsOn = append(dependsOn, positions[dependency])
+		}
+		sorted[position].dependsOn = dependsOn
+	}
+	return sorted
+}
+
+// getNeededFields returns the fields of @provider that are either requested
+// or depended upon and that it is the main provider of. The other fields are
+// not filled by it. Fields that depend on other fields of the same provider
+// come after them.
+func (p *plan) getNeededFields(provider FieldProvider) []Field {
+	fields := provider.Provides()
+	neededFields := make([]Field, 0, len(fields))
+	visited := newFieldNameSet(len(fields))
+
+	var visit func(field Field)
+	visit = func(field Field) {
+		if visited.Exists(field.Name) {
+			return
+		}
+		visited.Add(field.Name)
+		for _, dependency := range p.getActiveFieldDependencies(provider, field) {
+			dependency = p.resolveField(dependency)
+			if sibling, ok := getField(provider, dependency); ok && p.fieldProviders[dependency] == provider {
+				visit(sibling)
+			}
+		}
+		neededFields = append(neededFields, field)
+	}
+
+	for _, field := range fields {
+		if p.fieldProviders[field.Name] == provider {
+			visit(field)
+		}
+	}
+	return neededFields
+}
+
+// resolveField returns the subtree that provides the activated @field, if
+// it is not registered itself, or @field. See Field.Subtree.
+func (p *plan) resolveField(field FieldName) FieldName {
+	if owner, ok := p.fieldOwners[field]; ok {
+		return owner
+	}
+	return field
+}
+
+// isFieldRequested tells if @field is requested, either by name or through
+// a field nested under it.
+func (p *plan) isFieldRequested(field FieldName) bool {
+	for _, requested := range p.requestedFields {
+		if FieldName(requested) == field || strings.HasPrefix(requested, string(field)+fieldPathSeparator) {
+			return true
+		}
+	}
+	return false
 }
 
 func transformIntoIndexField(field FieldName) FieldName {
-	isIndexField := field[0] == '_'
+	isIndexField := strings.HasPrefix(string(field), "_")
 	if isIndexField {
 		// Notation: fields starting with '_' are always provided by the index
 		return field[1:]
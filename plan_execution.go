@@ -2,6 +2,10 @@ package queryplanner
 
 import (
 	"context"
+	stderrors "errors"
+	"slices"
+	"sort"
+	"sync"
 
 	"github.com/arquivei/foundationkit/errors"
 	"github.com/arquivei/foundationkit/trace"
@@ -11,6 +15,27 @@ type planExecution struct {
 	plan         *plan
 	data         *Payload
 	filledFields fieldNameSet
+	// providerCaches are the Caches of each provider, shared by its steps,
+	// and sharedCache is the Cache shared by all the providers. See
+	// ExecutionContext.Cache and ExecutionContext.SharedCache.
+	providerCaches map[FieldProvider]*Cache
+	sharedCache    *Cache
+
+	// failedFields and fieldErrors record the failures in partial results
+	// mode.
+	failedFields map[FieldName]map[int]struct{}
+	fieldErrors  []FieldError
+
+	// clearNonRequestedFields tells if the fields that were not requested
+	// are cleared from the documents. See Plan.Project.
+	clearNonRequestedFields bool
+
+	mu sync.Mutex
+}
+
+type stepExecutionResult struct {
+	step int
+	err  error
 }
 
 func (e *planExecution) start(ctx context.Context) error {
@@ -19,64 +44,438 @@ func (e *planExecution) start(ctx context.Context) error {
 	ctx, span := trace.StartSpan(ctx, op.String())
 	defer span.End(nil)
 
-	for _, provider := range e.plan.providers {
-		err := e.executeProvider(ctx, provider)
+	var err error
+	if e.plan.config.maxParallelism == 1 {
+		err = e.executeSequentially(ctx)
+	} else {
+		err = e.executeConcurrently(ctx)
+	}
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	if e.plan.config.partialResults {
+		sort.SliceStable(e.fieldErrors, func(i, j int) bool {
+			return e.fieldErrors[i].DocumentIndex < e.fieldErrors[j].DocumentIndex
+		})
+		e.data.Errors = e.fieldErrors
+	}
+
+	if e.clearNonRequestedFields {
+		e.clearNonRequestedFieldsFromDocuments()
+	}
+	return nil
+}
+
+func (e *planExecution) executeSequentially(ctx context.Context) error {
+	for _, step := range e.plan.steps {
+		err := e.executeProvider(ctx, step)
 		if err != nil {
-			return errors.E(op, err)
+			return err
 		}
 	}
-
-	e.clearNonRequestedFields()
 	return nil
 }
 
-func (e *planExecution) clearNonRequestedFields() {
-	requestedFields := e.plan.request.GetRequestedFields()
+// executeConcurrently runs each provider step as soon as all the steps it
+// depends on are done, limited by the configured max parallelism. The first
+// error cancels the context of the steps still running.
+func (e *planExecution) executeConcurrently(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	steps := e.plan.steps
+	pendingDependencies := make([]int, len(steps))
+	ready := make([]int, 0, len(steps))
+	for index, step := range steps {
+		pendingDependencies[index] = len(step.dependsOn)
+		if pendingDependencies[index] == 0 {
+			ready = append(ready, index)
+		}
+	}
+
+	results := make(chan stepExecutionResult)
+	running := 0
+	var firstErr error
+
+	for {
+		for len(ready) > 0 && firstErr == nil && e.canStartProvider(running) {
+			index := ready[0]
+			ready = ready[1:]
+			running++
+			go func() {
+				results <- stepExecutionResult{step: index, err: e.executeProvider(ctx, steps[index])}
+			}()
+		}
+		if running == 0 {
+			return firstErr
+		}
+
+		result := <-results
+		running--
+		if result.err != nil {
+			if firstErr == nil {
+				firstErr = result.err
+				cancel()
+			}
+			continue
+		}
 
+		for index, step := range steps {
+			if !slices.Contains(step.dependsOn, result.step) {
+				continue
+			}
+			pendingDependencies[index]--
+			if pendingDependencies[index] == 0 {
+				ready = append(ready, index)
+			}
+		}
+	}
+}
+
+func (e *planExecution) canStartProvider(running int) bool {
+	return e.plan.config.maxParallelism < 1 || running < e.plan.config.maxParallelism
+}
+
+func (e *planExecution) clearNonRequestedFieldsFromDocuments() {
 	for _, document := range e.data.Documents {
-		e.clearNonRequestedFieldsFromDocument(document, requestedFields)
+		e.clearNonRequestedFieldsFromDocument(document)
 	}
 }
 
-func (e *planExecution) executeProvider(ctx context.Context, provider FieldProvider) error {
+// executeProvider fills the fields of the @step of a provider.
+func (e *planExecution) executeProvider(ctx context.Context, step providerStep) error {
 	const op = errors.Op("planExecution.executeProvider")
 
 	executionContext := ExecutionContext{
-		Context: ctx,
-		Request: e.plan.request,
-		Payload: e.data,
-		cache:   newCache(),
+		Context:     ctx,
+		Request:     e.plan.request,
+		Payload:     e.data,
+		cache:       e.providerCaches[step.provider].withContext(ctx),
+		sharedCache: e.sharedCache.withContext(ctx),
 	}
 
-	for _, field := range provider.Provides() {
-		if e.filledFields.Exists(field.Name) {
+	for _, field := range step.fields {
+		if e.isFieldFilled(field.Name) {
 			continue
 		}
 
-		for index := range e.data.Documents {
-			err := field.Fill(index, executionContext)
+		err := e.fillField(executionContext, step.provider, field)
+		if err != nil {
+			return errors.E(op, err)
+		}
+		if field.Children != nil {
+			err = e.fillChildren(ctx, field)
 			if err != nil {
 				return errors.E(op, err)
 			}
-			e.filledFields.Add(field.Name)
 		}
+		e.setFieldFilled(field.Name)
 	}
 	return nil
 }
 
-func (e *planExecution) clearNonRequestedFieldsFromDocument(document Document, requestedFields []string) {
+// fillField fills @field in all the documents of the payload, skipping the
+// documents whose value is found in the entity cache. The fallbacks of the
+// field fill the documents the previous providers could not. In partial
+// results mode, failures are recorded in the payload instead of returned.
+func (e *planExecution) fillField(executionContext ExecutionContext, provider FieldProvider, field Field) error {
+	field = e.plan.config.completeField(field)
+	executionContext.arguments = e.plan.fieldArguments[field.Name]
+	documents := allDocumentIndexes(e.data.Documents)
+
+	entityCache := e.plan.config.entityCache
+	useEntityCache := entityCache != nil && field.Cache != nil
+	if useEntityCache {
+		documents = entityCache.load(field, formatArguments(executionContext.arguments), e.data.Documents, documents)
+	}
+	if len(documents) == 0 {
+		return nil
+	}
+
+	failures := make(map[int]FieldError)
+	pending := documents
+	alternatives := e.plan.getFieldAlternatives(provider, field)
+	for position, alternative := range alternatives {
+		isLast := position == len(alternatives)-1
+		pending = e.fillAlternative(executionContext, alternative, pending, failures, isLast)
+		if len(pending) == 0 {
+			break
+		}
+	}
+
+	if e.plan.config.partialResults {
+		e.recordFailures(documents, failures)
+	} else if failure, failed := getFirstFillFailure(documents, failures); failed {
+		return &ErrFillFailed{
+			Provider:      providerName(alternatives[len(alternatives)-1].provider),
+			Field:         field.Name,
+			DocumentIndex: failure.DocumentIndex,
+			Err:           failure.Err,
+		}
+	}
+
+	if useEntityCache {
+		arguments := formatArguments(executionContext.arguments)
+		entityCache.store(field, arguments, e.data.Documents, getFilledDocuments(documents, failures))
+	}
+	return nil
+}
+
+// fillAlternative fills the field with @alternative in the @documents and
+// returns the documents a fallback must fill. The reason of each failure is
+// stored in @failures. Unless @isLast, the documents in which the field was
+// left empty are also returned.
+func (e *planExecution) fillAlternative(
+	executionContext ExecutionContext,
+	alternative fieldAlternative,
+	documents []int,
+	failures map[int]FieldError,
+	isLast bool,
+) []int {
+	field := e.plan.config.completeField(alternative.field)
+	alternative.field = field
+	pending := make([]int, 0)
+	if e.plan.config.partialResults {
+		var skipped []int
+		documents, skipped = e.skipDocumentsWithFailedDependencies(alternative, documents, failures)
+		e.clearDocuments(field, skipped)
+		pending = append(pending, skipped...)
+	}
+	if len(documents) == 0 {
+		return pending
+	}
+
+	stopOnError := isLast && !e.plan.config.partialResults
+	errs := e.fillDocuments(executionContext, alternative.provider, field, documents, stopOnError)
+	for position, index := range documents {
+		if errs[position] != nil {
+			failures[index] = FieldError{DocumentIndex: index, Field: field.Name, Err: errs[position]}
+			e.plan.config.clear(field.Name, field.Clear, e.data.Documents[index])
+			pending = append(pending, index)
+			continue
+		}
+		delete(failures, index)
+		if !isLast && isFieldEmpty(field, e.data.Documents[index]) {
+			pending = append(pending, index)
+		}
+	}
+
+	sort.Ints(pending)
+	return pending
+}
+
+func isFieldEmpty(field Field, document Document) bool {
+	if field.Get == nil {
+		return false
+	}
+	_, found := field.Get(document)
+	return !found
+}
+
+func getFilledDocuments(documents []int, failures map[int]FieldError) []int {
+	filled := make([]int, 0, len(documents))
+	for _, index := range documents {
+		if _, failed := failures[index]; !failed {
+			filled = append(filled, index)
+		}
+	}
+	return filled
+}
+
+func allDocumentIndexes(documents []Document) []int {
+	indexes := make([]int, len(documents))
+	for index := range documents {
+		indexes[index] = index
+	}
+	return indexes
+}
+
+func (e *planExecution) clearDocuments(field Field, indexes []int) {
+	for _, index := range indexes {
+		e.plan.config.clear(field.Name, field.Clear, e.data.Documents[index])
+	}
+}
+
+// fillDocuments fills @field in the @documents of the payload and returns
+// the error of each document. If @stopOnError, it stops at the first error.
+func (e *planExecution) fillDocuments(
+	executionContext ExecutionContext,
+	provider FieldProvider,
+	field Field,
+	documents []int,
+	stopOnError bool,
+) []error {
+	errs := make([]error, len(documents))
+
+	if field.BatchFill != nil {
+		executionContext.documents = documents
+		err := field.BatchFill(executionContext)
+		for position := range errs {
+			errs[position] = err
+		}
+		return errs
+	}
+
+	concurrency := fillConcurrency(provider, field)
+	if concurrency <= 1 || len(documents) <= 1 {
+		for position, index := range documents {
+			errs[position] = field.Fill(index, executionContext)
+			if errs[position] != nil && stopOnError {
+				break
+			}
+		}
+		return errs
+	}
+
+	ctx, cancel := context.WithCancel(executionContext.Context)
+	defer cancel()
+	executionContext.Context = ctx
+	executionContext.cache = executionContext.Cache().withContext(ctx)
+	executionContext.sharedCache = executionContext.SharedCache().withContext(ctx)
+
+	positions := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < min(concurrency, len(documents)); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for position := range positions {
+				errs[position] = field.Fill(documents[position], executionContext)
+				if errs[position] != nil && stopOnError {
+					cancel()
+				}
+			}
+		}()
+	}
+
+	fed := 0
+feed:
+	for ; fed < len(documents); fed++ {
+		select {
+		case positions <- fed:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(positions)
+	wg.Wait()
+
+	// Documents that were not filled due to the cancellation.
+	for position := fed; position < len(documents); position++ {
+		errs[position] = ctx.Err()
+	}
+	return errs
+}
+
+// skipDocumentsWithFailedDependencies stores the @documents in which a
+// dependency of @alternative failed as skipped in @failures and returns the
+// remaining ones.
+func (e *planExecution) skipDocumentsWithFailedDependencies(
+	alternative fieldAlternative,
+	documents []int,
+	failures map[int]FieldError,
+) (remaining, skipped []int) {
+	field := alternative.field
+	dependencies := getFieldDependencies(alternative.provider, field)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	remaining = make([]int, 0, len(documents))
+	for _, index := range documents {
+		failedDependency, failed := e.getFailedDependency(dependencies, index)
+		if !failed {
+			remaining = append(remaining, index)
+			continue
+		}
+		skipped = append(skipped, index)
+		failures[index] = FieldError{DocumentIndex: index, Field: field.Name, SkippedBecause: failedDependency}
+	}
+	return remaining, skipped
+}
+
+func (e *planExecution) getFailedDependency(dependencies []FieldName, document int) (FieldName, bool) {
+	for _, dependency := range dependencies {
+		if _, failed := e.failedFields[dependency][document]; failed {
+			return dependency, true
+		}
+		if _, failed := e.failedFields[e.plan.resolveField(dependency)][document]; failed {
+			return dependency, true
+		}
+	}
+	return "", false
+}
+
+// recordFailures records the @failures of the @documents.
+func (e *planExecution) recordFailures(documents []int, failures map[int]FieldError) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, index := range documents {
+		if failure, failed := failures[index]; failed {
+			e.addFailure(failure)
+		}
+	}
+}
+
+// addFailure must be called with e.mu locked.
+func (e *planExecution) addFailure(fieldError FieldError) {
+	if e.failedFields[fieldError.Field] == nil {
+		e.failedFields[fieldError.Field] = make(map[int]struct{})
+	}
+	e.failedFields[fieldError.Field][fieldError.DocumentIndex] = struct{}{}
+	e.fieldErrors = append(e.fieldErrors, fieldError)
+}
+
+// getFirstFillFailure returns the failure of the first of the @documents
+// that failed. Failures caused by the cancellation that follows a failure
+// are only returned if there is no other failure.
+func getFirstFillFailure(documents []int, failures map[int]FieldError) (FieldError, bool) {
+	var canceled *FieldError
+	for _, index := range documents {
+		failure, failed := failures[index]
+		if !failed {
+			continue
+		}
+		if !stderrors.Is(failure.Err, context.Canceled) {
+			return failure, true
+		}
+		if canceled == nil {
+			canceled = &failure
+		}
+	}
+	if canceled == nil {
+		return FieldError{}, false
+	}
+	return *canceled, true
+}
+
+func (e *planExecution) isFieldFilled(field FieldName) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.filledFields.Exists(field)
+}
+
+func (e *planExecution) setFieldFilled(field FieldName) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.filledFields.Add(field)
+}
+
+func (e *planExecution) clearNonRequestedFieldsFromDocument(document Document) {
 	for _, field := range e.plan.indexProvider.Provides() {
-		isRequestedField := isInArray(string(field.Name), requestedFields)
+		isRequestedField := e.plan.isFieldRequested(field.Name)
 		if !isRequestedField {
-			field.Clear(document)
+			e.plan.config.clear(field.Name, field.Clear, document)
 		}
 	}
 
 	for _, provider := range e.plan.providers {
 		for _, field := range provider.Provides() {
-			isRequestedField := isInArray(string(field.Name), requestedFields)
+			isRequestedField := e.plan.isFieldRequested(field.Name)
 			if !isRequestedField {
-				field.Clear(document)
+				e.plan.config.clear(field.Name, field.Clear, document)
 			}
 		}
 	}
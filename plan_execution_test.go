@@ -0,0 +1,1028 @@
+package queryplanner
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/foundationkit/ref"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFillField(name FieldName, fill func(int, ExecutionContext) error) Field {
+	field := newNoopField(name)
+	field.Fill = fill
+	return field
+}
+
+func TestPlanExecution_ConcurrentProviders(t *testing.T) {
+	t.Parallel()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	bothStarted := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(bothStarted)
+	}()
+
+	var once [2]sync.Once
+	waitForEachOther := func(i int) func(int, ExecutionContext) error {
+		return func(int, ExecutionContext) error {
+			once[i].Do(wg.Done)
+			select {
+			case <-bothStarted:
+				return nil
+			case <-time.After(time.Second):
+				return errors.New("providers were not executed concurrently")
+			}
+		}
+	}
+
+	var calledAfterDependencies atomic.Bool
+	providers := []*fieldProviderMock{
+		{name: "b-provider", dependsOn: []FieldName{"a"}, provides: []Field{newFillField("b", waitForEachOther(0))}},
+		{name: "c-provider", dependsOn: []FieldName{"a"}, provides: []Field{newFillField("c", waitForEachOther(1))}},
+		{
+			name:      "d-provider",
+			dependsOn: []FieldName{"b", "c"},
+			provides: []Field{newFillField("d", func(int, ExecutionContext) error {
+				select {
+				case <-bothStarted:
+					calledAfterDependencies.Store(true)
+				default:
+				}
+				return nil
+			})},
+		},
+	}
+	indexProvider := &indexProviderMock{
+		provides: []Index{newNoopIndex("a")},
+		data:     &Payload{Documents: wrapDocuments([]*document{{}})},
+	}
+
+	planner, err := NewQueryPlannerWithOptions(indexProvider, wrapProviders(providers), WithMaxParallelism(2))
+	require.NoError(t, err)
+
+	_, err = planner.NewPlan(&requestMock{[]string{"d"}}).Execute(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, calledAfterDependencies.Load())
+}
+
+// concurrencyBarrier records how many callers of enter run at the same time.
+// The callers block until @limit of them have entered, which proves the
+// limit is reached, or until a timeout, after which reached is false.
+type concurrencyBarrier struct {
+	limit      int32
+	running    atomic.Int32
+	maxRunning atomic.Int32
+	once       sync.Once
+	full       chan struct{}
+}
+
+func newConcurrencyBarrier(limit int32) *concurrencyBarrier {
+	return &concurrencyBarrier{limit: limit, full: make(chan struct{})}
+}
+
+func (b *concurrencyBarrier) enter() {
+	current := b.running.Add(1)
+	defer b.running.Add(-1)
+	for {
+		observed := b.maxRunning.Load()
+		if current <= observed || b.maxRunning.CompareAndSwap(observed, current) {
+			break
+		}
+	}
+	if current >= b.limit {
+		b.once.Do(func() { close(b.full) })
+	}
+	select {
+	case <-b.full:
+	case <-time.After(5 * time.Second):
+	}
+}
+
+func (b *concurrencyBarrier) reached() bool {
+	select {
+	case <-b.full:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestPlanExecution_ConcurrentProviders_MaxParallelism(t *testing.T) {
+	t.Parallel()
+
+	barrier := newConcurrencyBarrier(2)
+	fill := func(int, ExecutionContext) error {
+		barrier.enter()
+		return nil
+	}
+
+	providers := []*fieldProviderMock{
+		{name: "a-provider", provides: []Field{newFillField("a", fill)}},
+		{name: "b-provider", provides: []Field{newFillField("b", fill)}},
+		{name: "c-provider", provides: []Field{newFillField("c", fill)}},
+		{name: "d-provider", provides: []Field{newFillField("d", fill)}},
+	}
+	indexProvider := &indexProviderMock{
+		data: &Payload{Documents: wrapDocuments([]*document{{}})},
+	}
+
+	planner, err := NewQueryPlannerWithOptions(indexProvider, wrapProviders(providers), WithMaxParallelism(2))
+	require.NoError(t, err)
+
+	_, err = planner.NewPlan(&requestMock{[]string{"a", "b", "c", "d"}}).Execute(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, barrier.reached())
+	assert.LessOrEqual(t, barrier.maxRunning.Load(), int32(2))
+}
+
+func TestPlanExecution_ConcurrentProviders_FirstErrorCancels(t *testing.T) {
+	t.Parallel()
+
+	var dependentCalled atomic.Bool
+	providers := []*fieldProviderMock{
+		{
+			name: "a-provider",
+			provides: []Field{newFillField("a", func(int, ExecutionContext) error {
+				return errors.New("problem filling a")
+			})},
+		},
+		{
+			name: "b-provider",
+			provides: []Field{newFillField("b", func(_ int, ec ExecutionContext) error {
+				<-ec.Context.Done()
+				return ec.Context.Err()
+			})},
+		},
+		{
+			name:      "c-provider",
+			dependsOn: []FieldName{"a"},
+			provides: []Field{newFillField("c", func(int, ExecutionContext) error {
+				dependentCalled.Store(true)
+				return nil
+			})},
+		},
+	}
+	indexProvider := &indexProviderMock{
+		data: &Payload{Documents: wrapDocuments([]*document{{}})},
+	}
+
+	planner, err := NewQueryPlannerWithOptions(indexProvider, wrapProviders(providers), WithMaxParallelism(0))
+	require.NoError(t, err)
+
+	_, err = planner.NewPlan(&requestMock{[]string{"b", "c"}}).Execute(context.Background())
+	assert.EqualError(t, err, "queryplanner.Plan.Execute: planExecution.start: planExecution.executeProvider: problem filling a")
+	assert.False(t, dependentCalled.Load())
+}
+
+type concurrentFieldProviderMock struct {
+	fieldProviderMock
+	concurrency int
+}
+
+func (m *concurrentFieldProviderMock) FillConcurrency() int {
+	return m.concurrency
+}
+
+func TestPlanExecution_ConcurrentFill(t *testing.T) {
+	t.Parallel()
+
+	newFill := func(barrier *concurrencyBarrier) func(int, ExecutionContext) error {
+		return func(index int, ec ExecutionContext) error {
+			barrier.enter()
+
+			doc := ec.Payload.Documents[index].(*document)
+			_, _ = ec.Cache().GetOrLoad("shared", func() (interface{}, error) { return nil, nil })
+			doc.a = doc.d
+			return nil
+		}
+	}
+
+	tests := []struct {
+		name        string
+		newProvider func(fill func(int, ExecutionContext) error) FieldProvider
+	}{
+		{
+			name: "per field",
+			newProvider: func(fill func(int, ExecutionContext) error) FieldProvider {
+				return &fieldProviderMock{
+					name:     "a-provider",
+					provides: []Field{{Name: "a", Fill: fill, Clear: func(Document) {}, MaxConcurrency: 3}},
+				}
+			},
+		},
+		{
+			name: "per provider",
+			newProvider: func(fill func(int, ExecutionContext) error) FieldProvider {
+				return &concurrentFieldProviderMock{
+					fieldProviderMock: fieldProviderMock{
+						name:     "a-provider",
+						provides: []Field{newFillField("a", fill)},
+					},
+					concurrency: 3,
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			barrier := newConcurrencyBarrier(3)
+			docs := make([]*document, 0, 7)
+			for _, value := range []string{"1", "2", "3", "4", "5", "6", "7"} {
+				docs = append(docs, &document{d: ref.Of(value)})
+			}
+			indexProvider := &indexProviderMock{
+				provides: []Index{newNoopIndex("d")},
+				data:     &Payload{Documents: wrapDocuments(docs)},
+			}
+
+			planner, err := NewQueryPlanner(indexProvider, test.newProvider(newFill(barrier)))
+			require.NoError(t, err)
+
+			_, err = planner.NewPlan(&requestMock{[]string{"a", "d"}}).Execute(context.Background())
+			require.NoError(t, err)
+
+			for _, doc := range docs {
+				assert.Equal(t, doc.d, doc.a)
+			}
+			assert.True(t, barrier.reached())
+			assert.LessOrEqual(t, barrier.maxRunning.Load(), int32(3))
+		})
+	}
+}
+
+func TestPlanExecution_ConcurrentFill_ReportsFirstDocumentError(t *testing.T) {
+	t.Parallel()
+
+	var started sync.WaitGroup
+	started.Add(4)
+	fill := func(index int, ec ExecutionContext) error {
+		started.Done()
+		started.Wait()
+		switch index {
+		case 1:
+			time.Sleep(10 * time.Millisecond)
+			return errors.New("problem filling document 1")
+		case 3:
+			return errors.New("problem filling document 3")
+		default:
+			<-ec.Context.Done()
+			return ec.Context.Err()
+		}
+	}
+
+	provider := &fieldProviderMock{
+		name:     "a-provider",
+		provides: []Field{{Name: "a", Fill: fill, Clear: func(Document) {}, MaxConcurrency: 4}},
+	}
+	indexProvider := &indexProviderMock{
+		data: &Payload{Documents: wrapDocuments([]*document{{}, {}, {}, {}})},
+	}
+
+	planner, err := NewQueryPlanner(indexProvider, provider)
+	require.NoError(t, err)
+
+	_, err = planner.NewPlan(&requestMock{[]string{"a"}}).Execute(context.Background())
+	assert.EqualError(t, err, "queryplanner.Plan.Execute: planExecution.start: planExecution.executeProvider: problem filling document 1")
+}
+
+//nolint:forcetypeassert
+func TestPlanExecution_BatchFill(t *testing.T) {
+	t.Parallel()
+
+	batchCalls := 0
+	providers := []*fieldProviderMock{
+		{
+			name:      "b-provider",
+			dependsOn: []FieldName{"d"},
+			provides: []Field{
+				{
+					Name: "b",
+					BatchFill: func(ec ExecutionContext) error {
+						batchCalls++
+						values := make([]string, 0, len(ec.Payload.Documents))
+						for _, d := range ec.Payload.Documents {
+							values = append(values, *d.(*document).d)
+						}
+						for i, d := range ec.Payload.Documents {
+							d.(*document).b = ref.Of(fmt.Sprintf("%s/%d", values[i], len(values)))
+						}
+						return nil
+					},
+					Clear: func(d Document) { d.(*document).b = nil },
+				},
+			},
+		},
+		{
+			name:      "a-provider",
+			dependsOn: []FieldName{"b"},
+			provides: []Field{newFillField("a", func(index int, ec ExecutionContext) error {
+				doc := ec.Payload.Documents[index].(*document)
+				doc.a = ref.Of("a:" + *doc.b)
+				return nil
+			})},
+		},
+	}
+	indexProvider := &indexProviderMock{
+		provides: []Index{{Name: "d", Clear: func(d Document) { d.(*document).d = nil }}},
+		data:     &Payload{Documents: wrapDocuments([]*document{{d: ref.Of("d1")}, {d: ref.Of("d2")}})},
+	}
+
+	planner, err := NewQueryPlanner(indexProvider, wrapProviders(providers)...)
+	require.NoError(t, err)
+
+	data, err := planner.NewPlan(&requestMock{[]string{"a", "b"}}).Execute(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, batchCalls)
+	assert.Equal(t, []*document{
+		{a: ref.Of("a:d1/2"), b: ref.Of("d1/2")},
+		{a: ref.Of("a:d2/2"), b: ref.Of("d2/2")},
+	}, unwrapDocuments(data.Documents))
+}
+
+func TestPlanExecution_OnlyNeededFieldsAreFilled(t *testing.T) {
+	t.Parallel()
+
+	var filledFields []FieldName
+	var mu sync.Mutex
+	newRecordingField := func(name FieldName) Field {
+		return newFillField(name, func(int, ExecutionContext) error {
+			mu.Lock()
+			defer mu.Unlock()
+			filledFields = append(filledFields, name)
+			return nil
+		})
+	}
+
+	providers := []*fieldProviderMock{
+		{
+			name:      "ab-provider",
+			dependsOn: []FieldName{"c"},
+			provides:  []Field{newRecordingField("a"), newRecordingField("b")},
+		},
+		{
+			name:     "cd-provider",
+			provides: []Field{newRecordingField("c"), newRecordingField("d")},
+		},
+	}
+	indexProvider := &indexProviderMock{
+		data: &Payload{Documents: wrapDocuments([]*document{{}})},
+	}
+
+	planner, err := NewQueryPlanner(indexProvider, wrapProviders(providers)...)
+	require.NoError(t, err)
+
+	_, err = planner.NewPlan(&requestMock{[]string{"a"}}).Execute(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []FieldName{"c", "a"}, filledFields)
+}
+
+func TestPlanExecution_PerFieldDependencies(t *testing.T) {
+	t.Parallel()
+
+	var filledFields []FieldName
+	newRecordingField := func(name FieldName, dependsOn ...FieldName) Field {
+		field := newFillField(name, func(int, ExecutionContext) error {
+			filledFields = append(filledFields, name)
+			return nil
+		})
+		field.DependsOn = dependsOn
+		return field
+	}
+
+	providers := []*fieldProviderMock{
+		{
+			name:      "person-provider",
+			dependsOn: []FieldName{"had_covid", "cpf"},
+			provides: []Field{
+				newRecordingField("full_name", "name"),
+				newRecordingField("name", "cpf"),
+				newRecordingField("vaccinated", "had_covid"),
+				newRecordingField("age", "birth"),
+			},
+		},
+		{
+			name:     "covid-provider",
+			provides: []Field{newRecordingField("had_covid", "cpf")},
+		},
+		{
+			name:     "birth-provider",
+			provides: []Field{newRecordingField("birth", "cpf")},
+		},
+	}
+	indexProvider := &indexProviderMock{
+		provides: []Index{newNoopIndex("cpf")},
+		data:     &Payload{Documents: wrapDocuments([]*document{{}})},
+	}
+
+	planner, err := NewQueryPlanner(indexProvider, wrapProviders(providers)...)
+	require.NoError(t, err)
+
+	p := planner.NewPlan(&requestMock{[]string{"full_name", "age"}})
+	assert.Equal(t, []ProviderExplanation{
+		{Name: "birth-provider", Fields: []FieldName{"birth"}, DependsOn: []FieldName{"cpf"}},
+		{Name: "person-provider", Fields: []FieldName{"name", "full_name", "age"}, DependsOn: []FieldName{"cpf", "name", "birth"}},
+	}, p.Explain().Providers)
+
+	_, err = p.Execute(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []FieldName{"birth", "name", "full_name", "age"}, filledFields)
+}
+
+func TestPlanExecution_ProviderSteps(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name                 string
+		providers            func(newField func(FieldName, ...FieldName) Field) []*fieldProviderMock
+		request              []string
+		expectedProviders    []ProviderExplanation
+		expectedFilledFields []FieldName
+	}{
+		{
+			name: "field depending on a provider that depends on a sibling",
+			providers: func(newField func(FieldName, ...FieldName) Field) []*fieldProviderMock {
+				return []*fieldProviderMock{
+					{name: "p", provides: []Field{newField("x"), newField("y", "z")}},
+					{name: "q", provides: []Field{newField("z", "x")}},
+				}
+			},
+			request: []string{"y"},
+			expectedProviders: []ProviderExplanation{
+				{Name: "p", Fields: []FieldName{"x"}, DependsOn: []FieldName{}},
+				{Name: "q", Fields: []FieldName{"z"}, DependsOn: []FieldName{"x"}},
+				{Name: "p", Fields: []FieldName{"y"}, DependsOn: []FieldName{"z"}},
+			},
+			expectedFilledFields: []FieldName{"x", "z", "y"},
+		},
+		{
+			name: "provider depending on a sibling",
+			providers: func(newField func(FieldName, ...FieldName) Field) []*fieldProviderMock {
+				return []*fieldProviderMock{
+					{name: "a-provider", provides: []Field{newField("a", "b"), newField("c")}},
+					{name: "b-provider", provides: []Field{newField("b", "c")}},
+				}
+			},
+			request: []string{"a", "c"},
+			expectedProviders: []ProviderExplanation{
+				{Name: "a-provider", Fields: []FieldName{"c"}, DependsOn: []FieldName{}},
+				{Name: "b-provider", Fields: []FieldName{"b"}, DependsOn: []FieldName{"c"}},
+				{Name: "a-provider", Fields: []FieldName{"a"}, DependsOn: []FieldName{"b"}},
+			},
+			expectedFilledFields: []FieldName{"c", "b", "a"},
+		},
+	}
+	for _, test := range tests {
+		for _, parallelism := range []int{1, 0} {
+			t.Run(fmt.Sprintf("%s with max parallelism %d", test.name, parallelism), func(t *testing.T) {
+				t.Parallel()
+
+				var mu sync.Mutex
+				var filledFields []FieldName
+				var loads atomic.Int32
+				newRecordingField := func(name FieldName, dependsOn ...FieldName) Field {
+					field := newFillField(name, func(_ int, ec ExecutionContext) error {
+						_, err := ec.Cache().GetOrLoad("provider", func() (interface{}, error) {
+							loads.Add(1)
+							return nil, nil
+						})
+						mu.Lock()
+						defer mu.Unlock()
+						filledFields = append(filledFields, name)
+						return err
+					})
+					field.DependsOn = append([]FieldName{}, dependsOn...)
+					return field
+				}
+				providers := test.providers(newRecordingField)
+				indexProvider := &indexProviderMock{data: &Payload{Documents: wrapDocuments([]*document{{}})}}
+
+				planner, err := NewQueryPlannerWithOptions(indexProvider, wrapProviders(providers), WithMaxParallelism(parallelism))
+				require.NoError(t, err)
+
+				p := planner.NewPlan(&requestMock{test.request})
+				assert.Equal(t, test.expectedProviders, p.Explain().Providers)
+
+				_, err = p.Execute(context.Background())
+				require.NoError(t, err)
+				assert.Equal(t, test.expectedFilledFields, filledFields)
+				// The steps of a provider share its Cache.
+				assert.Equal(t, int32(len(providers)), loads.Load())
+			})
+		}
+	}
+}
+
+func TestPlanExecution_CacheScope(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name                string
+		getCache            func(ExecutionContext) *Cache
+		expectedLoaderCalls int
+	}{
+		{
+			name:                "provider scoped",
+			getCache:            func(ec ExecutionContext) *Cache { return ec.Cache() },
+			expectedLoaderCalls: 2,
+		},
+		{
+			name:                "shared",
+			getCache:            func(ec ExecutionContext) *Cache { return ec.SharedCache() },
+			expectedLoaderCalls: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			loaderCalls := 0
+			fill := func(_ int, ec ExecutionContext) error {
+				_, err := test.getCache(ec).GetOrLoad("gov-record", func() (interface{}, error) {
+					loaderCalls++
+					return nil, nil
+				})
+				return err
+			}
+			providers := []*fieldProviderMock{
+				{name: "a-provider", provides: []Field{newFillField("a", fill)}},
+				{name: "b-provider", provides: []Field{newFillField("b", fill)}},
+			}
+			indexProvider := &indexProviderMock{
+				data: &Payload{Documents: wrapDocuments([]*document{{}, {}})},
+			}
+
+			planner, err := NewQueryPlanner(indexProvider, wrapProviders(providers)...)
+			require.NoError(t, err)
+
+			_, err = planner.NewPlan(&requestMock{[]string{"a", "b"}}).Execute(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedLoaderCalls, loaderCalls)
+		})
+	}
+}
+
+//nolint:forcetypeassert
+func TestPlanExecution_PartialResults(t *testing.T) {
+	t.Parallel()
+
+	errFillingB := errors.New("problem filling b")
+	setter := func(set func(doc *document, value *string), value string) func(int, ExecutionContext) error {
+		return func(index int, ec ExecutionContext) error {
+			set(ec.Payload.Documents[index].(*document), ref.Of(value))
+			return nil
+		}
+	}
+
+	providers := []*fieldProviderMock{
+		{
+			name:      "a-provider",
+			dependsOn: []FieldName{"b"},
+			provides: []Field{{
+				Name:  "a",
+				Fill:  setter(func(doc *document, value *string) { doc.a = value }, "a"),
+				Clear: func(d Document) { d.(*document).a = nil },
+			}},
+		},
+		{
+			name:      "b-provider",
+			dependsOn: []FieldName{"d"},
+			provides: []Field{{
+				Name: "b",
+				Fill: func(index int, ec ExecutionContext) error {
+					doc := ec.Payload.Documents[index].(*document)
+					doc.b = ref.Of("partially filled b")
+					if *doc.d == "d2" {
+						return errFillingB
+					}
+					doc.b = ref.Of("b")
+					return nil
+				},
+				Clear: func(d Document) { d.(*document).b = nil },
+			}},
+		},
+		{
+			name: "c-provider",
+			provides: []Field{{
+				Name:  "c",
+				Fill:  setter(func(doc *document, value *string) { doc.c = value }, "c"),
+				Clear: func(d Document) { d.(*document).c = nil },
+			}},
+		},
+	}
+	indexProvider := &indexProviderMock{
+		provides: []Index{{Name: "d", Clear: func(d Document) { d.(*document).d = nil }}},
+		data: &Payload{
+			Documents: wrapDocuments([]*document{{d: ref.Of("d1")}, {d: ref.Of("d2")}, {d: ref.Of("d3")}}),
+		},
+	}
+
+	planner, err := NewQueryPlannerWithOptions(indexProvider, wrapProviders(providers), WithPartialResults())
+	require.NoError(t, err)
+
+	data, err := planner.NewPlan(&requestMock{[]string{"a", "b", "c"}}).Execute(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []*document{
+		{a: ref.Of("a"), b: ref.Of("b"), c: ref.Of("c")},
+		{c: ref.Of("c")},
+		{a: ref.Of("a"), b: ref.Of("b"), c: ref.Of("c")},
+	}, unwrapDocuments(data.Documents))
+	assert.Equal(t, []FieldError{
+		{DocumentIndex: 1, Field: "b", Err: errFillingB},
+		{DocumentIndex: 1, Field: "a", SkippedBecause: "b"},
+	}, data.Errors)
+	assert.EqualError(t, data.Errors[0], "field b of document 1 failed: problem filling b")
+	assert.EqualError(t, data.Errors[1], "field a of document 1 skipped: dependency b failed")
+}
+
+//nolint:forcetypeassert
+func TestPlanExecution_OptionalDependencies(t *testing.T) {
+	t.Parallel()
+
+	errFillingC := errors.New("problem filling c")
+	newSummaryField := func() Field {
+		return Field{
+			Name: "a",
+			Fill: func(index int, ec ExecutionContext) error {
+				doc := ec.Payload.Documents[index].(*document)
+				summary := "a"
+				for _, value := range []*string{doc.b, doc.c, doc.d, doc.e} {
+					if value != nil {
+						summary += "+" + *value
+					}
+				}
+				doc.a = ref.Of(summary)
+				return nil
+			},
+			Clear:             func(d Document) { d.(*document).a = nil },
+			OptionalDependsOn: []FieldName{"b", "c", "d", "e"},
+		}
+	}
+
+	tests := []struct {
+		name                string
+		request             []string
+		expectedIndexFields []string
+		expectedProviders   []ProviderExplanation
+		expectedDocument    *document
+		expectedErrors      []FieldError
+	}{
+		{
+			name:                "only cheap optional dependencies are activated",
+			request:             []string{"a"},
+			expectedIndexFields: []string{"d"},
+			expectedProviders: []ProviderExplanation{
+				{Name: "a-provider", Fields: []FieldName{"a"}, DependsOn: []FieldName{"d"}},
+			},
+			expectedDocument: &document{a: ref.Of("a+d")},
+		},
+		{
+			name:                "requested optional dependencies are filled first",
+			request:             []string{"a", "b", "c"},
+			expectedIndexFields: []string{"d"},
+			expectedProviders: []ProviderExplanation{
+				{Name: "b-provider", Fields: []FieldName{"b"}, DependsOn: []FieldName{}},
+				{Name: "c-provider", Fields: []FieldName{"c"}, DependsOn: []FieldName{}},
+				{Name: "a-provider", Fields: []FieldName{"a"}, DependsOn: []FieldName{"b", "c", "d"}},
+			},
+			expectedDocument: &document{a: ref.Of("a+b+d"), b: ref.Of("b")},
+			expectedErrors:   []FieldError{{DocumentIndex: 0, Field: "c", Err: errFillingC}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			providers := []*fieldProviderMock{
+				{name: "a-provider", provides: []Field{newSummaryField()}},
+				{name: "b-provider", provides: []Field{{
+					Name: "b",
+					Fill: func(index int, ec ExecutionContext) error {
+						ec.Payload.Documents[index].(*document).b = ref.Of("b")
+						return nil
+					},
+					Clear: func(d Document) { d.(*document).b = nil },
+				}}},
+				{name: "c-provider", provides: []Field{{
+					Name:  "c",
+					Fill:  func(int, ExecutionContext) error { return errFillingC },
+					Clear: func(d Document) { d.(*document).c = nil },
+				}}},
+			}
+			var fetchedFields []string
+			indexProvider := &indexProviderMock{
+				provides: []Index{{Name: "d", Clear: func(d Document) { d.(*document).d = nil }}},
+				execute: func(_ *indexProviderMock, _ context.Context, _ Request, fields []string) (*Payload, error) {
+					fetchedFields = fields
+					return &Payload{Documents: wrapDocuments([]*document{{d: ref.Of("d")}})}, nil
+				},
+			}
+
+			planner, err := NewQueryPlannerWithOptions(indexProvider, wrapProviders(providers), WithPartialResults())
+			require.NoError(t, err)
+
+			p := planner.NewPlan(&requestMock{test.request})
+			assert.Equal(t, test.expectedProviders, p.Explain().Providers)
+
+			data, err := p.Execute(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedIndexFields, fetchedFields)
+			assert.Equal(t, []*document{test.expectedDocument}, unwrapDocuments(data.Documents))
+			assert.Equal(t, test.expectedErrors, data.Errors)
+		})
+	}
+}
+
+//nolint:forcetypeassert
+func TestPlanExecution_FallbackProviders(t *testing.T) {
+	t.Parallel()
+
+	errFromGov := errors.New("gov is down")
+	errFromReplica := errors.New("replica is down")
+	errFromCache := errors.New("cache is down")
+	newNameField := func(fill func(doc *document) error) Field {
+		return Field{
+			Name: "a",
+			Fill: func(index int, ec ExecutionContext) error {
+				return fill(ec.Payload.Documents[index].(*document))
+			},
+			Clear: func(d Document) { d.(*document).a = nil },
+			Get: func(d Document) (interface{}, bool) {
+				a := d.(*document).a
+				return a, a != nil
+			},
+		}
+	}
+
+	tests := []struct {
+		name              string
+		options           []Option
+		expectedDocuments []*document
+		expectedErrors    []FieldError
+		expectedErr       string
+	}{
+		{
+			name: "fallbacks fill failed and empty documents",
+			expectedDocuments: []*document{
+				{a: ref.Of("replica-1")},
+				{a: ref.Of("replica-2")},
+				{a: ref.Of("gov-3")},
+				{a: ref.Of("cache-4")},
+				{},
+			},
+		},
+		{
+			name:    "failures of the last fallback are partial results",
+			options: []Option{WithPartialResults()},
+			expectedDocuments: []*document{
+				{a: ref.Of("replica-1")},
+				{a: ref.Of("replica-2")},
+				{a: ref.Of("gov-3")},
+				{a: ref.Of("cache-4")},
+				{},
+				{},
+			},
+			expectedErrors: []FieldError{{DocumentIndex: 5, Field: "a", Err: errFromCache}},
+		},
+		{
+			name:        "failures of the last fallback fail the plan",
+			expectedErr: "queryplanner.Plan.Execute: planExecution.start: planExecution.executeProvider: cache is down",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			providers := []FieldProvider{
+				&prioritizedFieldProviderMock{
+					fieldProviderMock: fieldProviderMock{
+						name: "cache",
+						provides: []Field{newNameField(func(doc *document) error {
+							switch *doc.d {
+							case "4":
+								doc.a = ref.Of("cache-4")
+							case "6":
+								return errFromCache
+							}
+							return nil
+						})},
+					},
+					priority: 2,
+				},
+				&prioritizedFieldProviderMock{
+					fieldProviderMock: fieldProviderMock{
+						name:      "replica",
+						dependsOn: []FieldName{"b"},
+						provides: []Field{newNameField(func(doc *document) error {
+							switch *doc.d {
+							case "4", "6":
+								return errFromReplica
+							case "5":
+								return nil
+							}
+							doc.a = ref.Of(*doc.b + "-" + *doc.d)
+							return nil
+						})},
+					},
+					priority: 1,
+				},
+				&fieldProviderMock{
+					name: "gov",
+					provides: []Field{newNameField(func(doc *document) error {
+						switch *doc.d {
+						case "1", "4", "6":
+							return errFromGov
+						case "3":
+							doc.a = ref.Of("gov-3")
+						}
+						return nil
+					})},
+				},
+				&fieldProviderMock{
+					name: "b-provider",
+					provides: []Field{{
+						Name: "b",
+						Fill: func(index int, ec ExecutionContext) error {
+							ec.Payload.Documents[index].(*document).b = ref.Of("replica")
+							return nil
+						},
+						Clear: func(d Document) { d.(*document).b = nil },
+					}},
+				},
+			}
+			documents := []*document{{d: ref.Of("1")}, {d: ref.Of("2")}, {d: ref.Of("3")}, {d: ref.Of("4")}, {d: ref.Of("5")}}
+			if test.expectedErr != "" || test.expectedErrors != nil {
+				documents = append(documents, &document{d: ref.Of("6")})
+			}
+			indexProvider := &indexProviderMock{
+				provides: []Index{{Name: "d", Clear: func(d Document) { d.(*document).d = nil }}},
+				data:     &Payload{Documents: wrapDocuments(documents)},
+			}
+
+			planner, err := NewQueryPlannerWithOptions(indexProvider, providers, test.options...)
+			require.NoError(t, err)
+
+			p := planner.NewPlan(&requestMock{[]string{"a"}})
+			data, err := p.Execute(context.Background())
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedDocuments, unwrapDocuments(data.Documents))
+			assert.Equal(t, test.expectedErrors, data.Errors)
+		})
+	}
+}
+
+type conditionalFieldProviderMock struct {
+	fieldProviderMock
+	priority int
+	enabled  func(Request) bool
+}
+
+func (m *conditionalFieldProviderMock) Priority() int {
+	return m.priority
+}
+
+func (m *conditionalFieldProviderMock) Enabled(request Request) bool {
+	return m.enabled(request)
+}
+
+//nolint:forcetypeassert
+func TestPlanExecution_ConditionalProviders(t *testing.T) {
+	t.Parallel()
+
+	isTenant := func(tenant string) func(Request) bool {
+		return func(request Request) bool {
+			return slices.Contains(request.GetRequestedFields(), "tenant:"+tenant)
+		}
+	}
+	setter := func(set func(doc *document, value *string), value string) func(int, ExecutionContext) error {
+		return func(index int, ec ExecutionContext) error {
+			set(ec.Payload.Documents[index].(*document), ref.Of(value))
+			return nil
+		}
+	}
+
+	tests := []struct {
+		name             string
+		request          []string
+		options          []Option
+		expectedSources  map[FieldName]string
+		expectedDocument *document
+		expectedErr      string
+	}{
+		{
+			name:             "enabled provider",
+			request:          []string{"a", "b", "tenant:acme"},
+			expectedSources:  map[FieldName]string{"a": "gov", "b": "b-provider", "c": "c-provider"},
+			expectedDocument: &document{a: ref.Of("gov"), b: ref.Of("b")},
+		},
+		{
+			name:             "disabled provider with an alternative",
+			request:          []string{"a", "b", "tenant:other"},
+			expectedSources:  map[FieldName]string{"a": "replica", "b": "b-provider"},
+			expectedDocument: &document{a: ref.Of("replica"), b: ref.Of("b")},
+		},
+		{
+			name:             "disabled provider without an alternative",
+			request:          []string{"a", "b"},
+			expectedSources:  map[FieldName]string{"a": DisabledSource, "b": "b-provider"},
+			expectedDocument: &document{b: ref.Of("b")},
+		},
+		{
+			name:            "rejected disabled provider",
+			request:         []string{"a", "b"},
+			options:         []Option{WithDisabledFieldPolicy(RejectDisabledFields)},
+			expectedSources: map[FieldName]string{"a": DisabledSource, "b": "b-provider"},
+			expectedErr:     "queryplanner.Plan.Execute: plan.disableField: field is only provided by disabled providers [field=a]",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			providers := []FieldProvider{
+				&conditionalFieldProviderMock{
+					fieldProviderMock: fieldProviderMock{
+						name:      "gov",
+						dependsOn: []FieldName{"c"},
+						provides: []Field{{
+							Name:  "a",
+							Fill:  setter(func(doc *document, value *string) { doc.a = value }, "gov"),
+							Clear: func(d Document) { d.(*document).a = nil },
+						}},
+					},
+					enabled: isTenant("acme"),
+				},
+				&conditionalFieldProviderMock{
+					fieldProviderMock: fieldProviderMock{
+						name: "replica",
+						provides: []Field{{
+							Name:  "a",
+							Fill:  setter(func(doc *document, value *string) { doc.a = value }, "replica"),
+							Clear: func(d Document) { d.(*document).a = nil },
+						}},
+					},
+					priority: 1,
+					enabled:  isTenant("other"),
+				},
+				&fieldProviderMock{
+					name:      "b-provider",
+					dependsOn: []FieldName{"a"},
+					provides: []Field{{
+						Name:  "b",
+						Fill:  setter(func(doc *document, value *string) { doc.b = value }, "b"),
+						Clear: func(d Document) { d.(*document).b = nil },
+					}},
+				},
+				&fieldProviderMock{
+					name: "c-provider",
+					provides: []Field{{
+						Name:  "c",
+						Fill:  setter(func(doc *document, value *string) { doc.c = value }, "c"),
+						Clear: func(d Document) { d.(*document).c = nil },
+					}},
+				},
+			}
+			indexProvider := &indexProviderMock{
+				provides: []Index{newNoopIndex("tenant:acme"), newNoopIndex("tenant:other")},
+				data:     &Payload{Documents: wrapDocuments([]*document{{}})},
+			}
+
+			planner, err := NewQueryPlannerWithOptions(indexProvider, providers, test.options...)
+			require.NoError(t, err)
+
+			p := planner.NewPlan(&requestMock{test.request})
+			sources := make(map[FieldName]string)
+			for _, field := range p.Explain().Fields {
+				if field.Source != IndexSource {
+					sources[field.Name] = field.Source
+				}
+			}
+			assert.Equal(t, test.expectedSources, sources)
+
+			data, err := p.Execute(context.Background())
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, []*document{test.expectedDocument}, unwrapDocuments(data.Documents))
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package queryplanner
+
+import (
+	"context"
+
+	"github.com/arquivei/foundationkit/errors"
+)
+
+// Projection is the result of Plan.Project: the requested fields of each
+// document, read by their Get methods.
+type Projection struct {
+	// Documents has, for each document of the Payload, the requested fields
+	// that are set, keyed by their requested names. Fields that are not set,
+	// not requested or only used as dependencies are absent.
+	Documents  []map[string]interface{}
+	CustomData interface{}
+	Errors     []FieldError
+}
+
+// fieldGetter reads a requested field from the documents.
+type fieldGetter struct {
+	name string
+	get  func(Document) (interface{}, bool)
+}
+
+// Project runs a Plan and returns the requested fields of each document,
+// instead of clearing the fields that were not requested from the documents.
+// Every requested field must have a Get method. WithTaggedDocument, it may be
+// derived only for nillable struct fields, e.g. pointers, since the zero
+// value of the others, e.g. false, cannot be told from an unset field.
+func (p plan) Project(ctx context.Context) (*Projection, error) {
+	const op = errors.Op("queryplanner.Plan.Project")
+
+	if p.err != nil {
+		return nil, errors.E(op, p.err)
+	}
+
+	getters, err := p.getRequestedFieldGetters()
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	payload, err := p.execute(ctx, false)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	projection := &Projection{
+		Documents:  make([]map[string]interface{}, 0, len(payload.Documents)),
+		CustomData: payload.CustomData,
+		Errors:     payload.Errors,
+	}
+	for _, document := range payload.Documents {
+		projected := make(map[string]interface{}, len(getters))
+		for _, getter := range getters {
+			if value, found := getter.get(document); found {
+				projected[getter.name] = value
+			}
+		}
+		projection.Documents = append(projection.Documents, projected)
+	}
+	return projection, nil
+}
+
+// getRequestedFieldGetters returns the getters of the requested fields, with
+// the wildcards expanded. Disabled fields are left out, since they are never
+// filled.
+func (p plan) getRequestedFieldGetters() ([]fieldGetter, error) {
+	const op = errors.Op("plan.getRequestedFieldGetters")
+
+	indexes := make(map[FieldName]Index)
+	for _, index := range p.indexProvider.Provides() {
+		indexes[index.Name] = index
+	}
+
+	getters := make([]fieldGetter, 0, len(p.requestedFields))
+	projected := newFieldNameSet(len(p.requestedFields))
+	for _, name := range p.requestedFields {
+		// The wildcards left after the expansion are forwarded to child
+		// planners, whose fields are projected by their parent field.
+		if isWildcard(name) || projected.Exists(FieldName(name)) || p.disabledFields.Exists(FieldName(name)) {
+			continue
+		}
+		projected.Add(FieldName(name))
+
+		var get func(Document) (interface{}, bool)
+		if owner := p.resolveField(FieldName(name)); owner != FieldName(name) {
+			get = p.getAdapterGetter(FieldName(name))
+		} else if provider, ok := p.fieldProviders[FieldName(name)]; ok {
+			get = p.getFieldGetter(provider, FieldName(name))
+		} else if index, ok := indexes[transformIntoIndexField(FieldName(name))]; ok {
+			get = index.Get
+			if get == nil {
+				get = p.getAdapterGetter(index.Name)
+			}
+		}
+		if get == nil {
+			return nil, errors.E(op, "requested field has no `get` method", errors.KV("fieldName", name))
+		}
+		getters = append(getters, fieldGetter{name: name, get: get})
+	}
+	return getters, nil
+}
+
+// getFieldGetter returns the first Get of the providers of @field, or the
+// one derived from the document adapter. They all read the same field of the
+// documents.
+func (p plan) getFieldGetter(provider FieldProvider, name FieldName) func(Document) (interface{}, bool) {
+	field, _ := getField(provider, name)
+	for _, alternative := range p.getFieldAlternatives(provider, field) {
+		if alternative.field.Get != nil {
+			return alternative.field.Get
+		}
+	}
+	return p.getAdapterGetter(name)
+}
+
+// getAdapterGetter returns the getter of @field derived from the document
+// adapter, if any, and if it can tell whether the field is set. See
+// WithTaggedDocument.
+func (p plan) getAdapterGetter(field FieldName) func(Document) (interface{}, bool) {
+	adapter := p.config.documentAdapter
+	if adapter == nil || !adapter.canGet(field) {
+		return nil
+	}
+	return func(document Document) (interface{}, bool) {
+		return adapter.get(field, document)
+	}
+}
@@ -0,0 +1,157 @@
+package queryplanner
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan_Project(t *testing.T) {
+	t.Parallel()
+
+	type person struct {
+		cpf   string
+		name  string
+		age   int
+		score *int
+	}
+	getPerson := func(document Document) *person { return document.(*person) }
+	score := 10
+
+	providers := []FieldProvider{
+		&fieldProviderMock{
+			name:      "gov",
+			dependsOn: []FieldName{"cpf"},
+			provides: []Field{
+				{
+					Name: "name",
+					Fill: func(index int, ec ExecutionContext) error {
+						getPerson(ec.Payload.Documents[index]).name = "Maria"
+						return nil
+					},
+					Clear: func(Document) {},
+					Get:   func(document Document) (interface{}, bool) { return getPerson(document).name, true },
+				},
+			},
+		},
+		&fieldProviderMock{
+			name:      "score-provider",
+			dependsOn: []FieldName{"name"},
+			provides: []Field{
+				{
+					Name: "score",
+					Fill: func(index int, ec ExecutionContext) error {
+						if index == 0 {
+							getPerson(ec.Payload.Documents[index]).score = &score
+						}
+						return nil
+					},
+					Clear: func(Document) {},
+					Get: func(document Document) (interface{}, bool) {
+						p := getPerson(document)
+						if p.score == nil {
+							return nil, false
+						}
+						return *p.score, true
+					},
+				},
+			},
+		},
+	}
+	indexProvider := &indexProviderMock{
+		provides: []Index{
+			{Name: "cpf", Clear: func(Document) {}, Get: func(document Document) (interface{}, bool) { return getPerson(document).cpf, true }},
+			{Name: "age", Clear: func(Document) {}},
+		},
+		execute: func(*indexProviderMock, context.Context, Request, []string) (*Payload, error) {
+			return &Payload{Documents: []Document{&person{cpf: "1", age: 30}, &person{cpf: "2", age: 40}}, CustomData: "custom"}, nil
+		},
+	}
+
+	planner, err := NewQueryPlanner(indexProvider, providers...)
+	require.NoError(t, err)
+
+	projection, err := planner.NewPlan(&requestMock{[]string{"score", "_cpf", "score"}}).Project(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &Projection{
+		Documents: []map[string]interface{}{
+			{"score": 10, "_cpf": "1"},
+			{"_cpf": "2"},
+		},
+		CustomData: "custom",
+	}, projection)
+
+	encoded, err := json.Marshal(projection.Documents)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"score": 10, "_cpf": "1"}, {"_cpf": "2"}]`, string(encoded))
+
+	_, err = planner.NewPlan(&requestMock{[]string{"name", "age"}}).Project(context.Background())
+	assert.EqualError(t, err, "queryplanner.Plan.Project: plan.getRequestedFieldGetters: requested field has no `get` method [fieldName=age]")
+}
+
+func TestPlan_Project_MapDocuments(t *testing.T) {
+	t.Parallel()
+
+	providers := []FieldProvider{
+		&fieldProviderMock{
+			name:      "gov",
+			dependsOn: []FieldName{"cpf"},
+			provides: []Field{
+				{Name: "name", FillValue: func(int, ExecutionContext) (interface{}, error) { return "Maria", nil }},
+				{Name: "address.city", FillValue: func(int, ExecutionContext) (interface{}, error) { return nil, nil }},
+			},
+		},
+	}
+	indexProvider := &indexProviderMock{
+		provides: []Index{{Name: "cpf"}},
+		execute: func(*indexProviderMock, context.Context, Request, []string) (*Payload, error) {
+			return &Payload{Documents: []Document{MapDocument{"cpf": "1", "secret": "s"}}}, nil
+		},
+	}
+
+	planner, err := NewQueryPlannerWithOptions(indexProvider, providers, WithMapDocuments())
+	require.NoError(t, err)
+
+	projection, err := planner.NewPlan(&requestMock{[]string{"name", "address.city"}}).Project(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"name": "Maria"}}, projection.Documents)
+}
+
+func TestPlan_Project_TaggedDocument(t *testing.T) {
+	t.Parallel()
+
+	hadCovid := false
+	providers := []FieldProvider{
+		&fieldProviderMock{
+			name:      "gov",
+			dependsOn: []FieldName{"cpf"},
+			provides: []Field{
+				{Name: "name", FillValue: func(int, ExecutionContext) (interface{}, error) { return "", nil }},
+				{Name: "had_covid", FillValue: func(int, ExecutionContext) (interface{}, error) { return &hadCovid, nil }},
+			},
+		},
+	}
+	indexProvider := &indexProviderMock{
+		provides: []Index{{Name: "cpf"}, {Name: "city"}},
+		execute: func(*indexProviderMock, context.Context, Request, []string) (*Payload, error) {
+			return &Payload{Documents: []Document{&taggedPerson{CPF: "1"}}}, nil
+		},
+	}
+
+	planner, err := NewQueryPlannerWithOptions(indexProvider, providers, WithTaggedDocument((*taggedPerson)(nil)))
+	require.NoError(t, err)
+
+	projection, err := planner.NewPlan(&requestMock{[]string{"had_covid"}}).Project(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"had_covid": &hadCovid}}, projection.Documents)
+
+	// The zero value of non-pointer struct fields cannot be told from an
+	// unset field.
+	for _, field := range []string{"name", "cpf"} {
+		_, err = planner.NewPlan(&requestMock{[]string{field}}).Project(context.Background())
+		assert.EqualError(t, err, "queryplanner.Plan.Project: plan.getRequestedFieldGetters: requested field has no `get` method [fieldName="+field+"]")
+	}
+}
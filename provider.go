@@ -1,6 +1,9 @@
 package queryplanner
 
-import "context"
+import (
+	"context"
+	"fmt"
+)
 
 // FieldProvider is able to load an existing set of []Document with certain
 // fields. The `Provides()` returns a list of Field's, which in turn contains
@@ -20,3 +23,158 @@ type IndexProvider interface {
 	Execute(ctx context.Context, request Request, fields []string) (*Payload, error)
 	Provides() []Index
 }
+
+// NamedFieldProvider is an optional interface a FieldProvider may implement
+// to be identified by a human readable name, e.g. in plan explanations.
+type NamedFieldProvider interface {
+	FieldProvider
+	Name() string
+}
+
+// OptionalDependenciesProvider is an optional interface a FieldProvider may
+// implement to declare optional dependencies for its fields. See
+// Field.OptionalDependsOn.
+type OptionalDependenciesProvider interface {
+	FieldProvider
+	OptionalDependsOn() []FieldName
+}
+
+// PrioritizedFieldProvider is an optional interface a FieldProvider may
+// implement to provide fields that are also provided by other providers.
+// Each field is filled by its provider with the lowest Priority(). The other
+// providers of the field are fallbacks: they are tried in priority order for
+// the documents in which the previous providers failed or, if the field
+// defines Get, left the field empty. Providers that do not implement it have
+// priority 0, and a field may not have two providers with the same priority.
+type PrioritizedFieldProvider interface {
+	FieldProvider
+	Priority() int
+}
+
+// ConditionalFieldProvider is an optional interface a FieldProvider may
+// implement to apply only to some requests, e.g. of certain tenants. For the
+// requests it is disabled for, its fields are filled by their other enabled
+// providers, if any. Otherwise, the fields are handled according to the
+// DisabledFieldPolicy, and their dependencies are not activated.
+type ConditionalFieldProvider interface {
+	FieldProvider
+	Enabled(Request) bool
+}
+
+// ConcurrentFieldProvider is an optional interface a FieldProvider may
+// implement to fill up to FillConcurrency() documents at the same time. It
+// applies to the provider's fields that do not set Field.MaxConcurrency.
+//
+// The Fill functions of such providers must be safe for concurrent use.
+type ConcurrentFieldProvider interface {
+	FieldProvider
+	FillConcurrency() int
+}
+
+// providerName returns the name of the provider. If it does not implement
+// NamedFieldProvider, its type name is used instead.
+func providerName(provider FieldProvider) string {
+	if named, ok := provider.(NamedFieldProvider); ok {
+		return named.Name()
+	}
+	return fmt.Sprintf("%T", provider)
+}
+
+// providerPriority returns the priority of @provider. See
+// PrioritizedFieldProvider.
+func providerPriority(provider FieldProvider) int {
+	if prioritized, ok := provider.(PrioritizedFieldProvider); ok {
+		return prioritized.Priority()
+	}
+	return 0
+}
+
+// isProviderEnabled tells if @provider applies to @request. See
+// ConditionalFieldProvider.
+func isProviderEnabled(provider FieldProvider, request Request) bool {
+	if conditional, ok := provider.(ConditionalFieldProvider); ok {
+		return conditional.Enabled(request)
+	}
+	return true
+}
+
+// fieldAlternative is a provider of a field along with its declaration of
+// the field.
+type fieldAlternative struct {
+	provider FieldProvider
+	field    Field
+}
+
+// getField returns the field of @provider named @fieldName.
+func getField(provider FieldProvider, fieldName FieldName) (Field, bool) {
+	for _, field := range provider.Provides() {
+		if field.Name == fieldName {
+			return field, true
+		}
+	}
+	return Field{}, false
+}
+
+// getFieldDependencies returns the fields @field depends on, which default
+// to the dependencies of its @provider.
+func getFieldDependencies(provider FieldProvider, field Field) []FieldName {
+	if field.DependsOn != nil {
+		return field.DependsOn
+	}
+	return provider.DependsOn()
+}
+
+// getFieldOptionalDependencies returns the optional dependencies of @field,
+// which default to the optional dependencies of its @provider.
+func getFieldOptionalDependencies(provider FieldProvider, field Field) []FieldName {
+	if field.OptionalDependsOn != nil {
+		return field.OptionalDependsOn
+	}
+	if optional, ok := provider.(OptionalDependenciesProvider); ok {
+		return optional.OptionalDependsOn()
+	}
+	return nil
+}
+
+// getAllFieldDependencies returns both the required and the optional
+// dependencies of @field.
+func getAllFieldDependencies(provider FieldProvider, field Field) []FieldName {
+	dependencies := getFieldDependencies(provider, field)
+	optionalDependencies := getFieldOptionalDependencies(provider, field)
+	all := make([]FieldName, 0, len(dependencies)+len(optionalDependencies))
+	all = append(all, dependencies...)
+	return append(all, optionalDependencies...)
+}
+
+// getProviderDependencies returns the dependencies of all the @fields of
+// @provider, as returned by @getDependencies, without repetition.
+func getProviderDependencies(
+	provider FieldProvider,
+	fields []Field,
+	getDependencies func(FieldProvider, Field) []FieldName,
+) []FieldName {
+	dependencies := newFieldNameSet(0)
+	dependsOn := make([]FieldName, 0)
+	for _, field := range fields {
+		for _, dependency := range getDependencies(provider, field) {
+			if dependencies.Exists(dependency) {
+				continue
+			}
+			dependencies.Add(dependency)
+			dependsOn = append(dependsOn, dependency)
+		}
+	}
+	return dependsOn
+}
+
+// fillConcurrency returns how many documents of @field may be filled at the
+// same time.
+func fillConcurrency(provider FieldProvider, field Field) int {
+	if field.MaxConcurrency > 0 {
+		return field.MaxConcurrency
+	}
+	if concurrent, ok := provider.(ConcurrentFieldProvider); ok && concurrent.FillConcurrency() > 0 {
+		return concurrent.FillConcurrency()
+	}
+	return 1
+}
@@ -7,25 +7,57 @@ import (
 )
 
 // QueryPlanner is an interface that creates a Plan.
+//
+// NewPlan never fails: a Plan that cannot be executed returns the error when
+// executed. NewPlanE returns the error before executing anything, e.g. an
+// ErrUnknownFields if some requested fields are not registered.
 type QueryPlanner interface {
 	NewPlan(Request) Plan
+	NewPlanE(Request) (Plan, error)
+	DependencyGraph(Request) Graph
 }
 
 type queryPlanner struct {
 	fieldToProviderMap fieldProviderByName
 	indexProvider      IndexProvider
+	providers          []FieldProvider
+	config             config
 }
 
 // NewQueryPlanner returns a new query planner unsing @providers.
 func NewQueryPlanner(indexProvider IndexProvider, providers ...FieldProvider) (QueryPlanner, error) {
-	const op = errors.Op("queryplanner.NewQueryPlanner")
+	return newQueryPlanner(errors.Op("queryplanner.NewQueryPlanner"), indexProvider, providers, nil)
+}
+
+// NewQueryPlannerWithOptions returns a new query planner using @providers
+// and configured by @options.
+func NewQueryPlannerWithOptions(
+	indexProvider IndexProvider,
+	providers []FieldProvider,
+	options ...Option,
+) (QueryPlanner, error) {
+	return newQueryPlanner(errors.Op("queryplanner.NewQueryPlannerWithOptions"), indexProvider, providers, options)
+}
 
-	err := checkIfIndexProviderIsDeclaredCorrectly(indexProvider)
+func newQueryPlanner(
+	op errors.Op,
+	indexProvider IndexProvider,
+	providers []FieldProvider,
+	options []Option,
+) (QueryPlanner, error) {
+	config := newConfig(options)
+	documentAdapter, err := newDocumentAdapter(config)
 	if err != nil {
 		return nil, errors.E(op, err)
 	}
+	config.documentAdapter = documentAdapter
 
-	err = checkIfFieldProvidersAreDeclaredCorrectly(providers)
+	err = checkIfIndexProviderIsDeclaredCorrectly(indexProvider, config)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	err = checkIfFieldProvidersAreDeclaredCorrectly(providers, config)
 	if err != nil {
 		return nil, errors.E(op, err)
 	}
@@ -33,6 +65,7 @@ func NewQueryPlanner(indexProvider IndexProvider, providers ...FieldProvider) (Q
 	planner := &queryPlanner{
 		fieldToProviderMap: newFieldProviderByName(),
 		indexProvider:      indexProvider,
+		config:             config,
 	}
 
 	err = planner.registerProviders(providers...)
@@ -45,23 +78,77 @@ func NewQueryPlanner(indexProvider IndexProvider, providers ...FieldProvider) (Q
 		return nil, errors.E(op, err)
 	}
 
+	err = checkDependencies(planner.indexProvider, planner.providers, planner.fieldToProviderMap)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
 	return planner, nil
 }
 
 func (q *queryPlanner) NewPlan(request Request) Plan {
+	return q.newPlan(request)
+}
+
+func (q *queryPlanner) NewPlanE(request Request) (Plan, error) {
+	const op = errors.Op("queryplanner.NewPlanE")
+
+	if unknownFields := q.getUnknownFields(request); len(unknownFields) > 0 {
+		return nil, errors.E(op, &ErrUnknownFields{Fields: unknownFields})
+	}
+
+	p := q.newPlan(request)
+	if p.err != nil {
+		return nil, errors.E(op, p.err)
+	}
+
+	err := p.checkIfIndexHasTheNecessaryFields()
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	err = p.checkChildPlans()
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	return p, nil
+}
+
+func (q *queryPlanner) newPlan(request Request) plan {
 	p := plan{
 		fieldsToBeFetchedFromIndex: newFieldNameSet(0),
 		providers:                  make([]FieldProvider, 0),
 		indexProvider:              q.indexProvider,
 		request:                    request,
+		config:                     q.config,
 
 		processedFields:    newFieldNameSet(0),
 		processedProviders: newFieldProviderSet(0),
+
+		activatedBy: make(map[FieldName]FieldName),
+		requiredBy:  make(map[FieldName][]FieldName),
+
+		fieldProviders: make(map[FieldName]FieldProvider),
+		fieldFallbacks: make(map[FieldName][]fieldAlternative),
+
+		selectedProviders: make(map[FieldName]FieldProvider),
+
+		enabledProviders: make(map[FieldProvider]bool),
+		disabledFields:   newFieldNameSet(0),
+
+		fieldArguments: make(map[FieldName]FieldArguments),
+		fieldOwners:    make(map[FieldName]FieldName),
 	}
 
-	for _, field := range request.GetRequestedFields() {
-		p.activateField(FieldName(field), q.fieldToProviderMap)
+	requestedFields, arguments := parseRequestedFields(request.GetRequestedFields())
+	p.requestedFields = q.expandRequestedFields(&p, requestedFields)
+	for _, field := range p.requestedFields {
+		p.activateField(FieldName(field), "", q.fieldToProviderMap)
 	}
+	p.activateDeferredFields(q.fieldToProviderMap)
+	p.activateOptionalDependencies(q.fieldToProviderMap)
+	p.checkArguments(arguments, q.fieldToProviderMap)
+	p.scheduleProviders()
 
 	return p
 }
@@ -80,24 +167,39 @@ func (q *queryPlanner) registerProviders(providers ...FieldProvider) error {
 func (q *queryPlanner) registerProvider(provider FieldProvider) error {
 	const op = errors.Op("queryPlannerImpl.registerProvider")
 	for _, field := range provider.Provides() {
-		if _, foundProvider := q.fieldToProviderMap.GetByName(field.Name); foundProvider {
-			return errors.E(
-				op,
-				"two providers for the same field",
-				errors.KV("field", field.Name),
-			)
+		for _, registered := range q.fieldToProviderMap.GetAllByName(field.Name) {
+			if providerPriority(registered) == providerPriority(provider) {
+				return errors.E(
+					op,
+					&ErrDuplicateProvider{
+						Field:     field.Name,
+						Providers: []string{providerName(registered), providerName(provider)},
+					},
+					errors.KV("field", field.Name),
+				)
+			}
 		}
-		q.fieldToProviderMap.Add(field.Name, provider)
+		q.fieldToProviderMap.AddAlternative(field.Name, provider)
 	}
+	q.providers = append(q.providers, provider)
 	return nil
 }
 
-func checkIfIndexProviderIsDeclaredCorrectly(indexProvider IndexProvider) error {
+// checkIfIndexProviderIsDeclaredCorrectly ensures that every index can be
+// cleared. If the documents have an adapter, the indexes without Clear are
+// cleared by it.
+func checkIfIndexProviderIsDeclaredCorrectly(indexProvider IndexProvider, config config) error {
 	const op = errors.Op("checkIfIndexProviderIsDeclaredCorrectly")
 	if indexProvider == nil || reflect.ValueOf(indexProvider).IsNil() {
 		return errors.E(op, "indexProvider should not be nil")
 	}
 	for _, field := range indexProvider.Provides() {
+		if config.documentAdapter != nil {
+			if err := config.documentAdapter.checkField(field.Name); err != nil {
+				return errors.E(op, err)
+			}
+			continue
+		}
 		if field.Clear == nil {
 			return errors.E(op, "fieldprovider has no `clear` method defined", errors.KV("fieldName", field.Name))
 		}
@@ -105,14 +207,14 @@ func checkIfIndexProviderIsDeclaredCorrectly(indexProvider IndexProvider) error
 	return nil
 }
 
-func checkIfFieldProvidersAreDeclaredCorrectly(providers []FieldProvider) error {
+func checkIfFieldProvidersAreDeclaredCorrectly(providers []FieldProvider, config config) error {
 	const op = errors.Op("checkIfFieldProvidersAreDeclaredCorrectly")
 
 	for _, fieldProvider := range providers {
 		if fieldProvider == nil || reflect.ValueOf(fieldProvider).IsNil() {
 			return errors.E(op, "fieldprovider should not be nil")
 		}
-		err := checkMethodsFromFieldProvider(fieldProvider)
+		err := checkMethodsFromFieldProvider(fieldProvider, config)
 		if err != nil {
 			return errors.E(op, err)
 		}
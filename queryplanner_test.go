@@ -174,6 +174,45 @@ func TestQueryPlan_New(t *testing.T) {
 			expectedFieldsToBeFetchedFromIndex: nil,
 			expectedNewError:                   "queryplanner.NewQueryPlanner: checkIfFieldProvidersAreDeclaredCorrectly: checkMethodsFromFieldProvider: there is no `clear` method for field [fieldName=a]",
 		},
+		{
+			name: "[Success] FieldProvider may implement `BatchFill` instead of `Fill`",
+			providers: []FieldProvider{
+				&fieldProviderMock{
+					name: "a-provider",
+					provides: []Field{
+						{
+							Name:      "a",
+							BatchFill: func(_ ExecutionContext) error { return nil },
+							Clear:     func(_ Document) {},
+						},
+					},
+				},
+			},
+			indexProvider:                      &indexProviderMock{},
+			request:                            &requestMock{[]string{"a"}},
+			expectedFieldsToBeFetchedFromIndex: []string{},
+			expectedNewError:                   "",
+		},
+		{
+			name: "[Error] FieldProvider should not implement both `Fill` and `BatchFill` methods",
+			providers: []FieldProvider{
+				&fieldProviderMock{
+					name: "a-provider",
+					provides: []Field{
+						{
+							Name:      "a",
+							Fill:      func(_ int, _ ExecutionContext) error { return nil },
+							BatchFill: func(_ ExecutionContext) error { return nil },
+							Clear:     func(_ Document) {},
+						},
+					},
+				},
+			},
+			indexProvider:                      &indexProviderMock{},
+			request:                            &requestMock{[]string{}},
+			expectedFieldsToBeFetchedFromIndex: nil,
+			expectedNewError:                   "queryplanner.NewQueryPlanner: checkIfFieldProvidersAreDeclaredCorrectly: checkMethodsFromFieldProvider: field has both `fill' and `batchFill' methods [fieldName=a]",
+		},
 		{
 			name:      "[Error] IndexProvider should implement `Clear` methods",
 			providers: []FieldProvider{},
@@ -288,6 +327,109 @@ func TestQueryPlan_New(t *testing.T) {
 			expectedFieldsToBeFetchedFromIndex: []string{},
 			expectedNewError:                   "queryplanner.NewQueryPlanner: checkCycle: cycle found in field dependency [cycle= -> a -> b -> c -> a]",
 		},
+		{
+			name: "[Error] Dependency cycle with per-field dependencies",
+			providers: []FieldProvider{
+				&fieldProviderMock{
+					name: "a-provider",
+					provides: []Field{
+						{
+							Name:      "a",
+							Fill:      func(i int, executionContext ExecutionContext) error { return nil },
+							Clear:     func(d Document) {},
+							DependsOn: []FieldName{"b"},
+						},
+						{
+							Name:      "b",
+							Fill:      func(i int, executionContext ExecutionContext) error { return nil },
+							Clear:     func(d Document) {},
+							DependsOn: []FieldName{"a"},
+						},
+					},
+				},
+			},
+			indexProvider:                      &indexProviderMock{},
+			request:                            &requestMock{[]string{}},
+			expectedFieldsToBeFetchedFromIndex: []string{},
+			expectedNewError:                   "queryplanner.NewQueryPlanner: checkCycle: cycle found in field dependency [cycle= -> a -> b -> a]",
+		},
+		{
+			name: "[Error] Dependency cycle with optional dependencies",
+			providers: []FieldProvider{
+				&fieldProviderMock{
+					name: "a-provider",
+					provides: []Field{
+						{
+							Name:              "a",
+							Fill:              func(i int, executionContext ExecutionContext) error { return nil },
+							Clear:             func(d Document) {},
+							OptionalDependsOn: []FieldName{"b"},
+						},
+					},
+				},
+				&fieldProviderMock{
+					name:      "b-provider",
+					dependsOn: []FieldName{"a"},
+					provides: []Field{
+						{
+							Name:  "b",
+							Fill:  func(i int, executionContext ExecutionContext) error { return nil },
+							Clear: func(d Document) {},
+						},
+					},
+				},
+			},
+			indexProvider:                      &indexProviderMock{},
+			request:                            &requestMock{[]string{}},
+			expectedFieldsToBeFetchedFromIndex: []string{},
+			expectedNewError:                   "queryplanner.NewQueryPlanner: checkCycle: cycle found in field dependency [cycle= -> a -> b -> a]",
+		},
+		{
+			name: "[Error] Dependency cycle through a fallback provider",
+			providers: []FieldProvider{
+				&fieldProviderMock{
+					name:     "a-provider",
+					provides: []Field{newNoopField("a")},
+				},
+				&prioritizedFieldProviderMock{
+					fieldProviderMock: fieldProviderMock{
+						name:      "a-fallback",
+						dependsOn: []FieldName{"b"},
+						provides:  []Field{newNoopField("a")},
+					},
+					priority: 1,
+				},
+				&fieldProviderMock{
+					name:      "b-provider",
+					dependsOn: []FieldName{"a"},
+					provides:  []Field{newNoopField("b")},
+				},
+			},
+			indexProvider:                      &indexProviderMock{},
+			request:                            &requestMock{[]string{}},
+			expectedFieldsToBeFetchedFromIndex: []string{},
+			expectedNewError:                   "queryplanner.NewQueryPlanner: checkCycle: cycle found in field dependency [cycle= -> a -> b -> a]",
+		},
+		{
+			name: "[Success] Fallback FieldProviders for same Field",
+			providers: []FieldProvider{
+				&fieldProviderMock{
+					name:     "a-provider",
+					provides: []Field{newNoopField("a")},
+				},
+				&prioritizedFieldProviderMock{
+					fieldProviderMock: fieldProviderMock{
+						name:     "a-fallback",
+						provides: []Field{newNoopField("a")},
+					},
+					priority: 1,
+				},
+			},
+			indexProvider:                      &indexProviderMock{},
+			request:                            &requestMock{[]string{}},
+			expectedFieldsToBeFetchedFromIndex: []string{},
+			expectedNewError:                   "",
+		},
 		{
 			name: "[Error] Multiple FieldProviders for same Field",
 			providers: []FieldProvider{
@@ -1070,6 +1212,21 @@ func wrapProviders(mocks []*fieldProviderMock) []FieldProvider {
 	return providers
 }
 
+func newNoopField(name FieldName) Field {
+	return Field{
+		Name:  name,
+		Fill:  func(int, ExecutionContext) error { return nil },
+		Clear: func(Document) {},
+	}
+}
+
+func newNoopIndex(name FieldName) Index {
+	return Index{
+		Name:  name,
+		Clear: func(Document) {},
+	}
+}
+
 type indexProviderMock struct {
 	provides []Index
 	data     *Payload
@@ -1093,6 +1250,10 @@ type fieldProviderMock struct {
 	provides  []Field
 }
 
+func (m *fieldProviderMock) Name() string {
+	return m.name
+}
+
 func (m *fieldProviderMock) DependsOn() []FieldName {
 	return m.dependsOn
 }
@@ -1101,6 +1262,15 @@ func (m *fieldProviderMock) Provides() []Field {
 	return m.provides
 }
 
+type prioritizedFieldProviderMock struct {
+	fieldProviderMock
+	priority int
+}
+
+func (m *prioritizedFieldProviderMock) Priority() int {
+	return m.priority
+}
+
 type requestMock struct{ Fields []string }
 
 func (r *requestMock) GetRequestedFields() []string {
@@ -0,0 +1,134 @@
+package queryplanner
+
+import (
+	"reflect"
+
+	"github.com/arquivei/foundationkit/errors"
+)
+
+// documentTag is the struct tag that maps the struct fields of a document to
+// field names. See WithTaggedDocument.
+const documentTag = "qp"
+
+// taggedDocument maps field names to the struct fields of a document type
+// tagged with `qp:"<field name>"`.
+type taggedDocument struct {
+	documentType reflect.Type
+	fields       map[FieldName][]int
+}
+
+func newTaggedDocument(document Document) (*taggedDocument, error) {
+	const op = errors.Op("newTaggedDocument")
+
+	documentType := reflect.TypeOf(document)
+	if documentType == nil || documentType.Kind() != reflect.Pointer || documentType.Elem().Kind() != reflect.Struct {
+		return nil, errors.E(op, "tagged document must be a pointer to a struct", errors.KV("type", documentType))
+	}
+
+	fields := make(map[FieldName][]int)
+	for _, structField := range reflect.VisibleFields(documentType.Elem()) {
+		name, ok := structField.Tag.Lookup(documentTag)
+		if !ok || name == "" {
+			continue
+		}
+		if !structField.IsExported() {
+			return nil, errors.E(op, "tagged struct field is not exported", errors.KV("fieldName", name))
+		}
+		if _, isDuplicated := fields[FieldName(name)]; isDuplicated {
+			return nil, errors.E(op, "two struct fields with the same tag", errors.KV("fieldName", name))
+		}
+		fields[FieldName(name)] = structField.Index
+	}
+
+	return &taggedDocument{documentType: documentType, fields: fields}, nil
+}
+
+// checkField ensures that @field has a tagged struct field.
+func (t *taggedDocument) checkField(field FieldName) error {
+	const op = errors.Op("taggedDocument.checkField")
+	if _, ok := t.fields[field]; !ok {
+		return errors.E(op, "field has no tagged struct field", errors.KV("fieldName", field))
+	}
+	return nil
+}
+
+// clear sets the struct field tagged with @field to its zero value.
+// Documents of other types are ignored.
+func (t *taggedDocument) clear(field FieldName, document Document) {
+	_ = t.set(field, document, nil)
+}
+
+// get returns the value of the struct field tagged with @field. It is not
+// found if it is the zero value.
+func (t *taggedDocument) get(field FieldName, document Document) (interface{}, bool) {
+	structField, ok := t.getStructField(field, document)
+	if !ok || structField.IsZero() {
+		return nil, false
+	}
+	return structField.Interface(), true
+}
+
+// canGet tells if the struct field tagged with @field is nillable. The zero
+// value of the others, e.g. false or "", is taken as unset, so they cannot
+// be projected.
+func (t *taggedDocument) canGet(field FieldName) bool {
+	index, ok := t.fields[field]
+	if !ok {
+		return false
+	}
+	switch t.documentType.Elem().FieldByIndex(index).Type.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+		return true
+	default:
+		return false
+	}
+}
+
+// set sets the struct field tagged with @field to @value, which must be
+// assignable or convertible to it, e.g. an int64 into an int. A nil value
+// sets the zero value.
+func (t *taggedDocument) set(field FieldName, document Document, value interface{}) error {
+	const op = errors.Op("taggedDocument.set")
+
+	structField, ok := t.getStructField(field, document)
+	if !ok {
+		return nil
+	}
+	if value == nil {
+		structField.Set(reflect.Zero(structField.Type()))
+		return nil
+	}
+
+	reflectValue := reflect.ValueOf(value)
+	switch {
+	case reflectValue.Type().AssignableTo(structField.Type()):
+		structField.Set(reflectValue)
+	case isConvertible(reflectValue.Type(), structField.Type()):
+		structField.Set(reflectValue.Convert(structField.Type()))
+	default:
+		return errors.E(op, "value does not match the tagged struct field",
+			errors.KV("fieldName", field), errors.KV("type", reflectValue.Type()))
+	}
+	return nil
+}
+
+// isConvertible tells if values of type @from may be converted to @to.
+// Integers are not converted to strings, which would make them runes.
+func isConvertible(from, to reflect.Type) bool {
+	if to.Kind() == reflect.String && from.Kind() != reflect.String {
+		return false
+	}
+	return from.ConvertibleTo(to)
+}
+
+func (t *taggedDocument) getStructField(field FieldName, document Document) (reflect.Value, bool) {
+	index, ok := t.fields[field]
+	if !ok {
+		return reflect.Value{}, false
+	}
+	value := reflect.ValueOf(document)
+	if !value.IsValid() || value.Type() != t.documentType || value.IsNil() {
+		return reflect.Value{}, false
+	}
+	return value.Elem().FieldByIndex(index), true
+}
@@ -0,0 +1,294 @@
+package queryplanner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type taggedAddress struct {
+	City string `qp:"city"`
+}
+
+type taggedPerson struct {
+	taggedAddress
+	CPF      string `qp:"cpf"`
+	Name     string `qp:"name"`
+	HadCovid *bool  `qp:"had_covid"`
+	Age      int
+}
+
+func TestNewTaggedDocument(t *testing.T) {
+	t.Parallel()
+
+	type duplicatedTag struct {
+		A string `qp:"a"`
+		B string `qp:"a"`
+	}
+	type unexportedField struct {
+		a string `qp:"a"` //nolint:unused
+	}
+
+	tests := []struct {
+		name           string
+		document       Document
+		expectedFields []FieldName
+		expectedErr    string
+	}{
+		{
+			name:           "success",
+			document:       (*taggedPerson)(nil),
+			expectedFields: []FieldName{"city", "cpf", "name", "had_covid"},
+		},
+		{
+			name:        "not a pointer",
+			document:    taggedPerson{},
+			expectedErr: "newTaggedDocument: tagged document must be a pointer to a struct [type=queryplanner.taggedPerson]",
+		},
+		{
+			name:        "not a struct",
+			document:    new(string),
+			expectedErr: "newTaggedDocument: tagged document must be a pointer to a struct [type=*string]",
+		},
+		{
+			name:        "duplicated tag",
+			document:    (*duplicatedTag)(nil),
+			expectedErr: "newTaggedDocument: two struct fields with the same tag [fieldName=a]",
+		},
+		{
+			name:        "unexported field",
+			document:    (*unexportedField)(nil),
+			expectedErr: "newTaggedDocument: tagged struct field is not exported [fieldName=a]",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			tagged, err := newTaggedDocument(test.document)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			for _, field := range test.expectedFields {
+				assert.NoError(t, tagged.checkField(field))
+			}
+			assert.Len(t, tagged.fields, len(test.expectedFields))
+		})
+	}
+}
+
+func TestQueryPlanner_TaggedDocument(t *testing.T) {
+	t.Parallel()
+
+	newField := func(name FieldName) Field {
+		return Field{Name: name, Fill: func(int, ExecutionContext) error { return nil }}
+	}
+
+	tests := []struct {
+		name        string
+		indexes     []Index
+		provides    []Field
+		document    Document
+		expectedErr string
+	}{
+		{
+			name:     "success",
+			indexes:  []Index{{Name: "cpf"}, {Name: "city"}},
+			provides: []Field{newField("name"), newField("had_covid")},
+			document: (*taggedPerson)(nil),
+		},
+		{
+			name:        "index without tag",
+			indexes:     []Index{{Name: "cpf"}, {Name: "age"}},
+			provides:    []Field{newField("name")},
+			document:    (*taggedPerson)(nil),
+			expectedErr: "queryplanner.NewQueryPlannerWithOptions: checkIfIndexProviderIsDeclaredCorrectly: taggedDocument.checkField: field has no tagged struct field [fieldName=age]",
+		},
+		{
+			name:        "field without tag",
+			indexes:     []Index{{Name: "cpf"}},
+			provides:    []Field{newField("age")},
+			document:    (*taggedPerson)(nil),
+			expectedErr: "queryplanner.NewQueryPlannerWithOptions: checkIfFieldProvidersAreDeclaredCorrectly: checkMethodsFromFieldProvider: taggedDocument.checkField: field has no tagged struct field [fieldName=age]",
+		},
+		{
+			name:        "invalid document",
+			indexes:     []Index{{Name: "cpf"}},
+			provides:    []Field{newField("name")},
+			document:    taggedPerson{},
+			expectedErr: "queryplanner.NewQueryPlannerWithOptions: newDocumentAdapter: newTaggedDocument: tagged document must be a pointer to a struct [type=queryplanner.taggedPerson]",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewQueryPlannerWithOptions(
+				&indexProviderMock{provides: test.indexes},
+				[]FieldProvider{&fieldProviderMock{name: "gov", dependsOn: []FieldName{"cpf"}, provides: test.provides}},
+				WithTaggedDocument(test.document),
+			)
+			if test.expectedErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, test.expectedErr)
+		})
+	}
+}
+
+func TestPlanExecution_TaggedDocument(t *testing.T) {
+	t.Parallel()
+
+	hadCovid := true
+	fill := func(set func(*taggedPerson)) func(int, ExecutionContext) error {
+		return func(index int, ec ExecutionContext) error {
+			set(ec.Payload.Documents[index].(*taggedPerson))
+			return nil
+		}
+	}
+	providers := []FieldProvider{
+		&fieldProviderMock{
+			name:      "gov",
+			dependsOn: []FieldName{"cpf"},
+			provides: []Field{
+				{Name: "name", Fill: fill(func(p *taggedPerson) { p.Name = "Maria" })},
+				{Name: "had_covid", Fill: fill(func(p *taggedPerson) { p.HadCovid = &hadCovid })},
+			},
+		},
+	}
+	indexProvider := &indexProviderMock{
+		provides: []Index{{Name: "cpf"}, {Name: "city"}},
+		execute: func(*indexProviderMock, context.Context, Request, []string) (*Payload, error) {
+			return &Payload{Documents: []Document{
+				&taggedPerson{taggedAddress: taggedAddress{City: "Rio"}, CPF: "1", Age: 30},
+			}}, nil
+		},
+	}
+
+	planner, err := NewQueryPlannerWithOptions(indexProvider, providers, WithTaggedDocument((*taggedPerson)(nil)))
+	require.NoError(t, err)
+
+	payload, err := planner.NewPlan(&requestMock{[]string{"name"}}).Execute(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Document{&taggedPerson{Name: "Maria", Age: 30}}, payload.Documents)
+}
+
+func TestTaggedDocument_GetSet(t *testing.T) {
+	t.Parallel()
+
+	tagged, err := newTaggedDocument((*taggedPerson)(nil))
+	require.NoError(t, err)
+
+	person := &taggedPerson{CPF: "1"}
+	value, found := tagged.get("cpf", person)
+	assert.True(t, found)
+	assert.Equal(t, "1", value)
+
+	_, found = tagged.get("name", person)
+	assert.False(t, found)
+	_, found = tagged.get("cpf", MapDocument{"cpf": "1"})
+	assert.False(t, found)
+
+	require.NoError(t, tagged.set("city", person, "Rio"))
+	require.NoError(t, tagged.set("cpf", person, nil))
+	assert.Equal(t, &taggedPerson{taggedAddress: taggedAddress{City: "Rio"}}, person)
+
+	_, found = tagged.get("cpf", nil)
+	assert.False(t, found)
+	tagged.clear("cpf", nil)
+}
+
+func TestTaggedDocument_SetConversion(t *testing.T) {
+	t.Parallel()
+
+	type counter struct {
+		Count int    `qp:"count"`
+		Label string `qp:"label"`
+	}
+	tagged, err := newTaggedDocument((*counter)(nil))
+	require.NoError(t, err)
+
+	document := &counter{}
+	require.NoError(t, tagged.set("count", document, int64(3)))
+	assert.Equal(t, &counter{Count: 3}, document)
+
+	assert.EqualError(t, tagged.set("count", document, "3"),
+		"taggedDocument.set: value does not match the tagged struct field [fieldName=count, type=string]")
+	assert.EqualError(t, tagged.set("label", document, 3),
+		"taggedDocument.set: value does not match the tagged struct field [fieldName=label, type=int]")
+}
+
+func TestPlanExecution_TaggedDocument_FillValueMismatch(t *testing.T) {
+	t.Parallel()
+
+	providers := []FieldProvider{
+		&fieldProviderMock{
+			name:      "gov",
+			dependsOn: []FieldName{"cpf"},
+			provides: []Field{{
+				Name:      "name",
+				FillValue: func(int, ExecutionContext) (interface{}, error) { return 1, nil },
+			}},
+		},
+	}
+	indexProvider := &indexProviderMock{
+		provides: []Index{{Name: "cpf"}},
+		execute: func(*indexProviderMock, context.Context, Request, []string) (*Payload, error) {
+			return &Payload{Documents: []Document{&taggedPerson{CPF: "1"}}}, nil
+		},
+	}
+
+	planner, err := NewQueryPlannerWithOptions(indexProvider, providers, WithTaggedDocument((*taggedPerson)(nil)))
+	require.NoError(t, err)
+
+	_, err = planner.NewPlan(&requestMock{[]string{"name"}}).Execute(context.Background())
+	assert.ErrorContains(t, err, "taggedDocument.set: value does not match the tagged struct field [fieldName=name, type=int]")
+}
+
+func TestPlanExecution_TaggedDocument_ZeroValueFallback(t *testing.T) {
+	t.Parallel()
+
+	type vaccinated struct {
+		CPF        string `qp:"cpf"`
+		Vaccinated bool   `qp:"vaccinated"`
+	}
+	providers := []FieldProvider{
+		&fieldProviderMock{
+			name:      "gov",
+			dependsOn: []FieldName{"cpf"},
+			provides: []Field{{
+				Name:      "vaccinated",
+				FillValue: func(int, ExecutionContext) (interface{}, error) { return false, nil },
+			}},
+		},
+		&prioritizedFieldProviderMock{
+			fieldProviderMock: fieldProviderMock{
+				name:      "replica",
+				dependsOn: []FieldName{"cpf"},
+				provides: []Field{{
+					Name:      "vaccinated",
+					FillValue: func(int, ExecutionContext) (interface{}, error) { return true, nil },
+				}},
+			},
+			priority: 1,
+		},
+	}
+	indexProvider := &indexProviderMock{
+		provides: []Index{{Name: "cpf"}},
+		execute: func(*indexProviderMock, context.Context, Request, []string) (*Payload, error) {
+			return &Payload{Documents: []Document{&vaccinated{CPF: "1", Vaccinated: true}}}, nil
+		},
+	}
+
+	planner, err := NewQueryPlannerWithOptions(indexProvider, providers, WithTaggedDocument((*vaccinated)(nil)))
+	require.NoError(t, err)
+
+	payload, err := planner.NewPlan(&requestMock{[]string{"vaccinated"}}).Execute(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Document{&vaccinated{}}, payload.Documents)
+}
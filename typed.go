@@ -0,0 +1,341 @@
+package queryplanner
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+)
+
+// TypedField is a Field of documents of type D. D is usually a pointer to a
+// struct, since the values filled in a copy of a document are lost.
+//
+// Exactly one of Fill, BatchFill and FillValue must be set. BatchFill
+// receives the documents it must fill. The other members are the same as
+// Field's.
+type TypedField[D any] struct {
+	Name      FieldName
+	Fill      func(D, ExecutionContext) error
+	BatchFill func([]D, ExecutionContext) error
+	FillValue func(D, ExecutionContext) (interface{}, error)
+	Clear     func(D)
+
+	Arguments         []FieldArgument
+	Subtree           bool
+	Children          *TypedChildPlanner[D]
+	DependsOn         []FieldName
+	OptionalDependsOn []FieldName
+
+	Get func(D) (interface{}, bool)
+	Set func(D, interface{})
+
+	Cache *TypedFieldCacheConfig[D]
+
+	MaxConcurrency int
+}
+
+// TypedChildPlanner is the ChildPlanner of a TypedField.
+type TypedChildPlanner[D any] struct {
+	Planner QueryPlanner
+	Get     func(D) []Document
+}
+
+// TypedFieldCacheConfig is the FieldCacheConfig of a TypedField.
+type TypedFieldCacheConfig[D any] struct {
+	Key         func(D) (string, bool)
+	TTL         time.Duration
+	NegativeTTL time.Duration
+}
+
+// TypedFieldProvider is a FieldProvider of documents of type D. It may
+// implement the same optional interfaces as a FieldProvider, e.g.
+// NamedFieldProvider or PrioritizedFieldProvider.
+type TypedFieldProvider[D any] interface {
+	Provides() []TypedField[D]
+	DependsOn() []FieldName
+}
+
+// TypedIndex is an Index of documents of type D.
+type TypedIndex[D any] struct {
+	Name  FieldName
+	Clear func(D)
+	Get   func(D) (interface{}, bool)
+}
+
+// TypedIndexProvider is an IndexProvider of documents of type D.
+type TypedIndexProvider[D any] interface {
+	Execute(ctx context.Context, request Request, fields []string) (*TypedPayload[D], error)
+	Provides() []TypedIndex[D]
+}
+
+// TypedPayload is a Payload of documents of type D.
+type TypedPayload[D any] struct {
+	Documents  []D
+	CustomData interface{}
+	Errors     []FieldError
+}
+
+// TypedQueryPlanner is a QueryPlanner of documents of type D.
+type TypedQueryPlanner[D any] interface {
+	NewPlan(Request) TypedPlan[D]
+	NewPlanE(Request) (TypedPlan[D], error)
+	DependencyGraph(Request) Graph
+}
+
+// TypedPlan is a Plan of documents of type D.
+type TypedPlan[D any] interface {
+	Execute(context.Context) (*TypedPayload[D], error)
+	Project(context.Context) (*Projection, error)
+	Explain() Explanation
+}
+
+// NewTypedQueryPlanner returns a new query planner of documents of type D
+// using @providers and configured by @options.
+func NewTypedQueryPlanner[D any](
+	indexProvider TypedIndexProvider[D],
+	providers []TypedFieldProvider[D],
+	options ...Option,
+) (TypedQueryPlanner[D], error) {
+	const op = errors.Op("queryplanner.NewTypedQueryPlanner")
+
+	if indexProvider == nil || reflect.ValueOf(indexProvider).IsNil() {
+		return nil, errors.E(op, "indexProvider should not be nil")
+	}
+	fieldProviders := make([]FieldProvider, 0, len(providers))
+	for _, provider := range providers {
+		if provider == nil || reflect.ValueOf(provider).IsNil() {
+			return nil, errors.E(op, "fieldprovider should not be nil")
+		}
+		fieldProviders = append(fieldProviders, newTypedFieldProvider(provider))
+	}
+
+	planner, err := newQueryPlanner(op, &typedIndexProvider[D]{provider: indexProvider}, fieldProviders, options)
+	if err != nil {
+		return nil, err
+	}
+	return &typedQueryPlanner[D]{planner: planner}, nil
+}
+
+type typedQueryPlanner[D any] struct {
+	planner QueryPlanner
+}
+
+func (q *typedQueryPlanner[D]) NewPlan(request Request) TypedPlan[D] {
+	return typedPlan[D]{plan: q.planner.NewPlan(request)}
+}
+
+func (q *typedQueryPlanner[D]) NewPlanE(request Request) (TypedPlan[D], error) {
+	p, err := q.planner.NewPlanE(request)
+	if err != nil {
+		return nil, err
+	}
+	return typedPlan[D]{plan: p}, nil
+}
+
+func (q *typedQueryPlanner[D]) DependencyGraph(request Request) Graph {
+	return q.planner.DependencyGraph(request)
+}
+
+type typedPlan[D any] struct {
+	plan Plan
+}
+
+func (p typedPlan[D]) Execute(ctx context.Context) (*TypedPayload[D], error) {
+	payload, err := p.plan.Execute(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	documents := make([]D, 0, len(payload.Documents))
+	for _, document := range payload.Documents {
+		documents = append(documents, document.(D)) //nolint:forcetypeassert
+	}
+	return &TypedPayload[D]{
+		Documents:  documents,
+		CustomData: payload.CustomData,
+		Errors:     payload.Errors,
+	}, nil
+}
+
+func (p typedPlan[D]) Project(ctx context.Context) (*Projection, error) {
+	return p.plan.Project(ctx)
+}
+
+func (p typedPlan[D]) Explain() Explanation {
+	return p.plan.Explain()
+}
+
+// typedIndexProvider adapts a TypedIndexProvider into an IndexProvider.
+type typedIndexProvider[D any] struct {
+	provider TypedIndexProvider[D]
+}
+
+func (i *typedIndexProvider[D]) Execute(ctx context.Context, request Request, fields []string) (*Payload, error) {
+	payload, err := i.provider.Execute(ctx, request, fields)
+	if err != nil || payload == nil {
+		return nil, err
+	}
+
+	documents := make([]Document, 0, len(payload.Documents))
+	for _, document := range payload.Documents {
+		documents = append(documents, document)
+	}
+	return &Payload{Documents: documents, CustomData: payload.CustomData}, nil
+}
+
+func (i *typedIndexProvider[D]) Provides() []Index {
+	typedIndexes := i.provider.Provides()
+	indexes := make([]Index, 0, len(typedIndexes))
+	for _, typedIndex := range typedIndexes {
+		indexes = append(indexes, Index{
+			Name:  typedIndex.Name,
+			Clear: adaptClear(typedIndex.Clear),
+			Get:   adaptGet(typedIndex.Get),
+		})
+	}
+	return indexes
+}
+
+// typedFieldProvider adapts a TypedFieldProvider into a FieldProvider. It
+// implements all the optional interfaces, returning the same as a provider
+// that does not implement them if the adapted one does not.
+type typedFieldProvider[D any] struct {
+	provider TypedFieldProvider[D]
+	fields   []Field
+}
+
+func newTypedFieldProvider[D any](provider TypedFieldProvider[D]) *typedFieldProvider[D] {
+	typedFields := provider.Provides()
+	fields := make([]Field, 0, len(typedFields))
+	for _, typedField := range typedFields {
+		fields = append(fields, adaptField(typedField))
+	}
+	return &typedFieldProvider[D]{provider: provider, fields: fields}
+}
+
+func (p *typedFieldProvider[D]) DependsOn() []FieldName {
+	return p.provider.DependsOn()
+}
+
+func (p *typedFieldProvider[D]) Provides() []Field {
+	return p.fields
+}
+
+func (p *typedFieldProvider[D]) Name() string {
+	if named, ok := p.provider.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+	return fmt.Sprintf("%T", p.provider)
+}
+
+func (p *typedFieldProvider[D]) OptionalDependsOn() []FieldName {
+	if optional, ok := p.provider.(interface{ OptionalDependsOn() []FieldName }); ok {
+		return optional.OptionalDependsOn()
+	}
+	return nil
+}
+
+func (p *typedFieldProvider[D]) Priority() int {
+	if prioritized, ok := p.provider.(interface{ Priority() int }); ok {
+		return prioritized.Priority()
+	}
+	return 0
+}
+
+func (p *typedFieldProvider[D]) Cost(request Request) float64 {
+	if estimating, ok := p.provider.(interface{ Cost(Request) float64 }); ok {
+		return estimating.Cost(request)
+	}
+	return 1
+}
+
+func (p *typedFieldProvider[D]) Enabled(request Request) bool {
+	if conditional, ok := p.provider.(interface{ Enabled(Request) bool }); ok {
+		return conditional.Enabled(request)
+	}
+	return true
+}
+
+func (p *typedFieldProvider[D]) FillConcurrency() int {
+	if concurrent, ok := p.provider.(interface{ FillConcurrency() int }); ok {
+		return concurrent.FillConcurrency()
+	}
+	return 0
+}
+
+//nolint:forcetypeassert
+func adaptField[D any](typedField TypedField[D]) Field {
+	field := Field{
+		Name:              typedField.Name,
+		Clear:             adaptClear(typedField.Clear),
+		Arguments:         typedField.Arguments,
+		Subtree:           typedField.Subtree,
+		DependsOn:         typedField.DependsOn,
+		OptionalDependsOn: typedField.OptionalDependsOn,
+		MaxConcurrency:    typedField.MaxConcurrency,
+	}
+
+	if fill := typedField.Fill; fill != nil {
+		field.Fill = func(index int, ec ExecutionContext) error {
+			return fill(ec.Payload.Documents[index].(D), ec)
+		}
+	}
+	if fillValue := typedField.FillValue; fillValue != nil {
+		field.FillValue = func(index int, ec ExecutionContext) (interface{}, error) {
+			return fillValue(ec.Payload.Documents[index].(D), ec)
+		}
+	}
+	if batchFill := typedField.BatchFill; batchFill != nil {
+		field.BatchFill = func(ec ExecutionContext) error {
+			indexes := ec.DocumentIndexes()
+			documents := make([]D, 0, len(indexes))
+			for _, index := range indexes {
+				documents = append(documents, ec.Payload.Documents[index].(D))
+			}
+			return batchFill(documents, ec)
+		}
+	}
+	field.Get = adaptGet(typedField.Get)
+	if set := typedField.Set; set != nil {
+		field.Set = func(document Document, value interface{}) {
+			set(document.(D), value)
+		}
+	}
+	if children := typedField.Children; children != nil {
+		field.Children = &ChildPlanner{Planner: children.Planner}
+		if get := children.Get; get != nil {
+			field.Children.Get = func(document Document) []Document {
+				return get(document.(D))
+			}
+		}
+	}
+	if cache := typedField.Cache; cache != nil {
+		field.Cache = &FieldCacheConfig{TTL: cache.TTL, NegativeTTL: cache.NegativeTTL}
+		if key := cache.Key; key != nil {
+			field.Cache.Key = func(document Document) (string, bool) {
+				return key(document.(D))
+			}
+		}
+	}
+	return field
+}
+
+func adaptClear[D any](clear func(D)) func(Document) {
+	if clear == nil {
+		return nil
+	}
+	return func(document Document) {
+		clear(document.(D)) //nolint:forcetypeassert
+	}
+}
+
+func adaptGet[D any](get func(D) (interface{}, bool)) func(Document) (interface{}, bool) {
+	if get == nil {
+		return nil
+	}
+	return func(document Document) (interface{}, bool) {
+		return get(document.(D)) //nolint:forcetypeassert
+	}
+}
@@ -0,0 +1,213 @@
+package queryplanner
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/arquivei/foundationkit/ref"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type typedPerson struct {
+	CPF        string
+	Name       *string
+	Initials   *string
+	Age        *int
+	Dependents []*typedPerson
+}
+
+type typedIndexProviderMock struct {
+	documents []*typedPerson
+}
+
+func (i *typedIndexProviderMock) Execute(context.Context, Request, []string) (*TypedPayload[*typedPerson], error) {
+	return &TypedPayload[*typedPerson]{Documents: i.documents}, nil
+}
+
+func (i *typedIndexProviderMock) Provides() []TypedIndex[*typedPerson] {
+	return []TypedIndex[*typedPerson]{{Name: "cpf", Clear: func(p *typedPerson) { p.CPF = "" }}}
+}
+
+type typedFieldProviderMock struct {
+	dependsOn []FieldName
+	provides  []TypedField[*typedPerson]
+}
+
+func (m *typedFieldProviderMock) DependsOn() []FieldName {
+	return m.dependsOn
+}
+
+func (m *typedFieldProviderMock) Provides() []TypedField[*typedPerson] {
+	return m.provides
+}
+
+type namedTypedFieldProviderMock struct {
+	typedFieldProviderMock
+	name string
+}
+
+func (m *namedTypedFieldProviderMock) Name() string {
+	return m.name
+}
+
+func TestTypedQueryPlanner(t *testing.T) {
+	t.Parallel()
+
+	names := map[string]string{"1": "ada lovelace", "2": "alan turing"}
+	providers := []TypedFieldProvider[*typedPerson]{
+		&namedTypedFieldProviderMock{
+			name: "gov",
+			typedFieldProviderMock: typedFieldProviderMock{
+				dependsOn: []FieldName{"cpf"},
+				provides: []TypedField[*typedPerson]{
+					{
+						Name: "name",
+						BatchFill: func(people []*typedPerson, _ ExecutionContext) error {
+							for _, person := range people {
+								person.Name = ref.Of(names[person.CPF])
+							}
+							return nil
+						},
+						Clear: func(p *typedPerson) { p.Name = nil },
+					},
+					{
+						Name:  "age",
+						Fill:  func(p *typedPerson, _ ExecutionContext) error { p.Age = ref.Of(len(p.CPF)); return nil },
+						Clear: func(p *typedPerson) { p.Age = nil },
+					},
+				},
+			},
+		},
+		&typedFieldProviderMock{
+			dependsOn: []FieldName{"name"},
+			provides: []TypedField[*typedPerson]{{
+				Name: "initials",
+				Fill: func(p *typedPerson, _ ExecutionContext) error {
+					initials := ""
+					for _, word := range strings.Fields(*p.Name) {
+						initials += strings.ToUpper(word[:1])
+					}
+					p.Initials = ref.Of(initials)
+					return nil
+				},
+				Clear: func(p *typedPerson) { p.Initials = nil },
+			}},
+		},
+	}
+	indexProvider := &typedIndexProviderMock{
+		documents: []*typedPerson{{CPF: "1"}, {CPF: "2"}},
+	}
+
+	planner, err := NewTypedQueryPlanner[*typedPerson](indexProvider, providers)
+	require.NoError(t, err)
+
+	p, err := planner.NewPlanE(&requestMock{[]string{"initials"}})
+	require.NoError(t, err)
+	assert.Equal(t, []ProviderExplanation{
+		{Name: "gov", Fields: []FieldName{"name"}, DependsOn: []FieldName{"cpf"}},
+		{Name: "*queryplanner.typedFieldProviderMock", Fields: []FieldName{"initials"}, DependsOn: []FieldName{"name"}},
+	}, p.Explain().Providers)
+
+	payload, err := p.Execute(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []*typedPerson{
+		{Initials: ref.Of("AL")},
+		{Initials: ref.Of("AT")},
+	}, payload.Documents)
+}
+
+//nolint:forcetypeassert
+func TestTypedQueryPlanner_FillValueAndChildren(t *testing.T) {
+	t.Parallel()
+
+	childPlanner, err := NewQueryPlanner(
+		NewChildIndexProvider(Index{Name: "cpf", Clear: func(d Document) { d.(*typedPerson).CPF = "" }}),
+		&fieldProviderMock{
+			name:      "dependent-name-provider",
+			dependsOn: []FieldName{"cpf"},
+			provides: []Field{{
+				Name: "name",
+				FillValue: func(index int, ec ExecutionContext) (interface{}, error) {
+					return "name-" + ec.Payload.Documents[index].(*typedPerson).CPF, nil
+				},
+				Clear: func(d Document) { d.(*typedPerson).Name = nil },
+				Set:   func(d Document, value interface{}) { d.(*typedPerson).Name = ref.Of(value.(string)) },
+			}},
+		},
+	)
+	require.NoError(t, err)
+
+	providers := []TypedFieldProvider[*typedPerson]{
+		&typedFieldProviderMock{
+			dependsOn: []FieldName{"cpf"},
+			provides: []TypedField[*typedPerson]{
+				{
+					Name:      "age",
+					FillValue: func(p *typedPerson, _ ExecutionContext) (interface{}, error) { return len(p.CPF), nil },
+					Clear:     func(p *typedPerson) { p.Age = nil },
+					Set:       func(p *typedPerson, value interface{}) { p.Age = ref.Of(value.(int)) },
+				},
+				{
+					Name: "dependents",
+					Fill: func(p *typedPerson, _ ExecutionContext) error {
+						p.Dependents = []*typedPerson{{CPF: p.CPF + "1"}}
+						return nil
+					},
+					Clear: func(p *typedPerson) { p.Dependents = nil },
+					Children: &TypedChildPlanner[*typedPerson]{
+						Planner: childPlanner,
+						Get: func(p *typedPerson) []Document {
+							children := make([]Document, 0, len(p.Dependents))
+							for _, dependent := range p.Dependents {
+								children = append(children, dependent)
+							}
+							return children
+						},
+					},
+				},
+			},
+		},
+	}
+	indexProvider := &typedIndexProviderMock{
+		documents: []*typedPerson{{CPF: "1"}, {CPF: "22"}},
+	}
+
+	planner, err := NewTypedQueryPlanner[*typedPerson](indexProvider, providers)
+	require.NoError(t, err)
+
+	payload, err := planner.NewPlan(&requestMock{[]string{"age", "dependents.name"}}).Execute(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []*typedPerson{
+		{Age: ref.Of(1), Dependents: []*typedPerson{{Name: ref.Of("name-11")}}},
+		{Age: ref.Of(2), Dependents: []*typedPerson{{Name: ref.Of("name-221")}}},
+	}, payload.Documents)
+}
+
+func TestNewTypedQueryPlanner_Errors(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewTypedQueryPlanner[*typedPerson](nil, nil)
+	assert.EqualError(t, err, "queryplanner.NewTypedQueryPlanner: indexProvider should not be nil")
+
+	_, err = NewTypedQueryPlanner[*typedPerson](&typedIndexProviderMock{}, []TypedFieldProvider[*typedPerson]{
+		&typedFieldProviderMock{provides: []TypedField[*typedPerson]{{Name: "name", Clear: func(*typedPerson) {}}}},
+	})
+	assert.EqualError(t, err, "queryplanner.NewTypedQueryPlanner: checkIfFieldProvidersAreDeclaredCorrectly: "+
+		"checkMethodsFromFieldProvider: there is no `fill' method for field [fieldName=name]")
+}
+
+func TestTypedFieldProvider_DefaultOptionalInterfaces(t *testing.T) {
+	t.Parallel()
+
+	provider := newTypedFieldProvider[*typedPerson](&typedFieldProviderMock{})
+	request := &requestMock{}
+
+	assert.Equal(t, "*queryplanner.typedFieldProviderMock", providerName(provider))
+	assert.Equal(t, 0, providerPriority(provider))
+	assert.Equal(t, 1.0, providerCost(provider, request))
+	assert.True(t, isProviderEnabled(provider, request))
+	assert.Equal(t, 1, fillConcurrency(provider, Field{}))
+	assert.Nil(t, getFieldOptionalDependencies(provider, Field{}))
+}
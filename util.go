@@ -1,8 +1,8 @@
 package queryplanner
 
-func isInArray(s string, arr []string) bool {
+func isProviderInArray(provider FieldProvider, arr []FieldProvider) bool {
 	for _, item := range arr {
-		if s == item {
+		if provider == item {
 			return true
 		}
 	}
@@ -0,0 +1,305 @@
+package queryplanner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/arquivei/foundationkit/errors"
+)
+
+// maxSuggestionDistance is the maximum edit distance between an unknown
+// field and a registered field suggested in its place.
+const maxSuggestionDistance = 3
+
+// UnknownField is a requested field that is provided neither by a
+// FieldProvider nor by the IndexProvider.
+type UnknownField struct {
+	Name FieldName
+	// Suggestion is the registered field with the closest name, or empty if
+	// no name is close enough.
+	Suggestion FieldName
+}
+
+// ErrUnknownFields is returned by QueryPlanner.NewPlanE when some of the
+// requested fields are unknown. It matches any ErrUnknownFields with
+// errors.Is.
+type ErrUnknownFields struct {
+	Fields []UnknownField
+}
+
+func (e *ErrUnknownFields) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		if field.Suggestion == "" {
+			fields = append(fields, string(field.Name))
+			continue
+		}
+		fields = append(fields, fmt.Sprintf("%s (did you mean %s?)", field.Name, field.Suggestion))
+	}
+	return "unknown fields: " + strings.Join(fields, ", ")
+}
+
+// Is tells if @target is an ErrUnknownFields.
+func (e *ErrUnknownFields) Is(target error) bool {
+	_, ok := target.(*ErrUnknownFields)
+	return ok
+}
+
+// getUnknownFields returns the fields of @request that are not registered,
+// including the wildcards that match no registered field.
+func (q *queryPlanner) getUnknownFields(request Request) []UnknownField {
+	indexFields := q.indexProvider.Provides()
+	isIndexField := newFieldNameSet(len(indexFields))
+	for _, index := range indexFields {
+		isIndexField.Add(index.Name)
+	}
+	registeredFields := q.getRegisteredFieldNames()
+
+	requestedFields, _ := parseRequestedFields(request.GetRequestedFields())
+	var unknownFields []UnknownField
+	for _, requestedField := range requestedFields {
+		field := FieldName(requestedField)
+		if field == "" {
+			unknownFields = append(unknownFields, UnknownField{Name: field})
+			continue
+		}
+		if isWildcard(requestedField) {
+			if len(q.getWildcardMatches(requestedField, registeredFields)) == 0 {
+				unknownFields = append(unknownFields, UnknownField{Name: field})
+			}
+			continue
+		}
+		if _, isProvided := q.fieldToProviderMap.GetByName(q.fieldToProviderMap.Resolve(field)); isProvided {
+			continue
+		}
+		if isIndexField.Exists(transformIntoIndexField(field)) {
+			continue
+		}
+		unknownFields = append(unknownFields, UnknownField{
+			Name:       field,
+			Suggestion: getClosestFieldName(field, registeredFields),
+		})
+	}
+	return unknownFields
+}
+
+// getRegisteredFieldNames returns the names of the fields of all providers,
+// sorted.
+func (q *queryPlanner) getRegisteredFieldNames() []FieldName {
+	names := q.fieldToProviderMap.GetFieldNames()
+	for _, index := range q.indexProvider.Provides() {
+		names = append(names, string(index.Name))
+	}
+	sort.Strings(names)
+
+	fields := make([]FieldName, 0, len(names))
+	for i, name := range names {
+		if i > 0 && names[i-1] == name {
+			continue
+		}
+		fields = append(fields, FieldName(name))
+	}
+	return fields
+}
+
+// getClosestFieldName returns the name in @candidates with the lowest edit
+// distance to @field, if it is at most maxSuggestionDistance and shorter
+// than @field itself.
+func getClosestFieldName(field FieldName, candidates []FieldName) FieldName {
+	var closest FieldName
+	lowestDistance := min(maxSuggestionDistance+1, len(field))
+	for _, candidate := range candidates {
+		distance := levenshteinDistance(string(field), string(candidate))
+		if distance < lowestDistance {
+			closest, lowestDistance = candidate, distance
+		}
+	}
+	return closest
+}
+
+// levenshteinDistance returns the minimum number of single character
+// insertions, deletions and substitutions that turn @a into @b.
+func levenshteinDistance(a, b string) int {
+	source, target := []rune(a), []rune(b)
+	previous := make([]int, len(target)+1)
+	current := make([]int, len(target)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(source); i++ {
+		current[0] = i
+		for j := 1; j <= len(target); j++ {
+			substitution := previous[j-1]
+			if source[i-1] != target[j-1] {
+				substitution++
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, substitution)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(target)]
+}
+
+// InvalidDependency is a dependency of a field that cannot be satisfied.
+type InvalidDependency struct {
+	Provider   string
+	Field      FieldName
+	Dependency FieldName
+}
+
+// ErrInvalidGraph is returned when creating a QueryPlanner whose dependency
+// graph has problems that would otherwise only surface when a request
+// activates them. It matches any ErrInvalidGraph with errors.Is.
+type ErrInvalidGraph struct {
+	// DanglingDependencies are dependencies provided neither by a
+	// FieldProvider nor by the IndexProvider.
+	DanglingDependencies []InvalidDependency
+	// UnsupportedIndexDependencies are `_` prefixed dependencies on fields
+	// the IndexProvider does not provide.
+	UnsupportedIndexDependencies []InvalidDependency
+	// UnreachableProviders are the providers whose fields all depend,
+	// directly or not, on invalid dependencies, so they can never be filled.
+	UnreachableProviders []string
+}
+
+func (e *ErrInvalidGraph) Error() string {
+	problems := make([]string, 0)
+	for _, dependency := range e.DanglingDependencies {
+		problems = append(problems, fmt.Sprintf(
+			"field %s of %s depends on unknown field %s",
+			dependency.Field, dependency.Provider, dependency.Dependency,
+		))
+	}
+	for _, dependency := range e.UnsupportedIndexDependencies {
+		problems = append(problems, fmt.Sprintf(
+			"field %s of %s depends on %s, which the index does not provide",
+			dependency.Field, dependency.Provider, dependency.Dependency,
+		))
+	}
+	for _, provider := range e.UnreachableProviders {
+		problems = append(problems, fmt.Sprintf("provider %s is unreachable", provider))
+	}
+	return "invalid dependency graph: " + strings.Join(problems, "; ")
+}
+
+// Is tells if @target is an ErrInvalidGraph.
+func (e *ErrInvalidGraph) Is(target error) bool {
+	_, ok := target.(*ErrInvalidGraph)
+	return ok
+}
+
+// checkDependencies ensures that every dependency of every field can be
+// satisfied. Optional dependencies may be missing, so they are not checked.
+// It must be called after the cycles are checked.
+func checkDependencies(
+	indexProvider IndexProvider,
+	providers []FieldProvider,
+	fieldToProviderMap fieldProviderByName,
+) error {
+	const op = errors.Op("checkDependencies")
+
+	indexFields := newFieldNameSet(0)
+	for _, index := range indexProvider.Provides() {
+		indexFields.Add(index.Name)
+	}
+
+	var invalidGraph ErrInvalidGraph
+	for _, provider := range providers {
+		for _, field := range provider.Provides() {
+			for _, dependency := range getFieldDependencies(provider, field) {
+				if dependency == "" {
+					invalidGraph.DanglingDependencies = append(invalidGraph.DanglingDependencies,
+						InvalidDependency{Provider: providerName(provider), Field: field.Name, Dependency: dependency})
+					continue
+				}
+				if _, isProvided := fieldToProviderMap.GetByName(fieldToProviderMap.Resolve(dependency)); isProvided && dependency[0] != '_' {
+					continue
+				}
+				if indexFields.Exists(transformIntoIndexField(dependency)) {
+					continue
+				}
+				invalidDependency := InvalidDependency{Provider: providerName(provider), Field: field.Name, Dependency: dependency}
+				if dependency[0] == '_' {
+					invalidGraph.UnsupportedIndexDependencies = append(invalidGraph.UnsupportedIndexDependencies, invalidDependency)
+				} else {
+					invalidGraph.DanglingDependencies = append(invalidGraph.DanglingDependencies, invalidDependency)
+				}
+			}
+		}
+	}
+
+	fillable := make(map[FieldName]bool)
+	for _, provider := range providers {
+		if !isProviderReachable(provider, indexFields, fieldToProviderMap, fillable) {
+			invalidGraph.UnreachableProviders = append(invalidGraph.UnreachableProviders, providerName(provider))
+		}
+	}
+
+	if invalidGraph.DanglingDependencies != nil ||
+		invalidGraph.UnsupportedIndexDependencies != nil ||
+		invalidGraph.UnreachableProviders != nil {
+		return errors.E(op, &invalidGraph)
+	}
+	return nil
+}
+
+// isProviderReachable tells if any field of @provider can be filled.
+func isProviderReachable(
+	provider FieldProvider,
+	indexFields fieldNameSet,
+	fieldToProviderMap fieldProviderByName,
+	fillable map[FieldName]bool,
+) bool {
+	for _, field := range provider.Provides() {
+		if isAlternativeFillable(fieldAlternative{provider: provider, field: field}, indexFields, fieldToProviderMap, fillable) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAlternativeFillable tells if all the dependencies of @alternative can
+// be filled.
+func isAlternativeFillable(
+	alternative fieldAlternative,
+	indexFields fieldNameSet,
+	fieldToProviderMap fieldProviderByName,
+	fillable map[FieldName]bool,
+) bool {
+	for _, dependency := range getFieldDependencies(alternative.provider, alternative.field) {
+		if !isFieldFillable(dependency, indexFields, fieldToProviderMap, fillable) {
+			return false
+		}
+	}
+	return true
+}
+
+// isFieldFillable tells if any provider of @field can fill it or if the
+// index provides it. The results are memoized in @fillable.
+func isFieldFillable(
+	field FieldName,
+	indexFields fieldNameSet,
+	fieldToProviderMap fieldProviderByName,
+	fillable map[FieldName]bool,
+) bool {
+	field = fieldToProviderMap.Resolve(field)
+	if isFillable, ok := fillable[field]; ok {
+		return isFillable
+	}
+
+	isFillable := false
+	if _, isProvided := fieldToProviderMap.GetByName(field); !isProvided || field[0] == '_' {
+		isFillable = indexFields.Exists(transformIntoIndexField(field))
+	}
+	for _, alternative := range fieldToProviderMap.GetAlternativesByName(field) {
+		if isFillable {
+			break
+		}
+		isFillable = isAlternativeFillable(alternative, indexFields, fieldToProviderMap, fillable)
+	}
+
+	fillable[field] = isFillable
+	return isFillable
+}
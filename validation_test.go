@@ -0,0 +1,163 @@
+package queryplanner
+
+import (
+	stderrors "errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryPlanner_NewPlanE(t *testing.T) {
+	t.Parallel()
+
+	providers := []FieldProvider{
+		&fieldProviderMock{name: "gov", dependsOn: []FieldName{"cpf"}, provides: []Field{newNoopField("name"), newNoopField("had_covid")}},
+	}
+	indexProvider := &indexProviderMock{
+		provides: []Index{newNoopIndex("cpf"), newNoopIndex("date")},
+	}
+
+	tests := []struct {
+		name                  string
+		request               []string
+		expectedUnknownFields []UnknownField
+		expectedErr           string
+	}{
+		{
+			name:    "known fields",
+			request: []string{"name", "cpf", "_date"},
+		},
+		{
+			name:    "unknown fields",
+			request: []string{"nmae", "had_covid", "hadcovid", "foo", "_name", "x"},
+			expectedUnknownFields: []UnknownField{
+				{Name: "nmae", Suggestion: "name"},
+				{Name: "hadcovid", Suggestion: "had_covid"},
+				{Name: "foo"},
+				{Name: "_name", Suggestion: "name"},
+				{Name: "x"},
+			},
+			expectedErr: "queryplanner.NewPlanE: unknown fields: nmae (did you mean name?), hadcovid (did you mean had_covid?), foo, _name (did you mean name?), x",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			planner, err := NewQueryPlanner(indexProvider, providers...)
+			require.NoError(t, err)
+
+			p, err := planner.NewPlanE(&requestMock{test.request})
+			if test.expectedErr == "" {
+				assert.NoError(t, err)
+				assert.NotNil(t, p)
+				return
+			}
+			assert.Nil(t, p)
+			assert.EqualError(t, err, test.expectedErr)
+
+			var unknownFieldsErr *ErrUnknownFields
+			if test.expectedUnknownFields == nil {
+				assert.False(t, stderrors.As(err, &unknownFieldsErr))
+				return
+			}
+			require.True(t, stderrors.As(err, &unknownFieldsErr))
+			assert.Equal(t, test.expectedUnknownFields, unknownFieldsErr.Fields)
+		})
+	}
+}
+
+func TestQueryPlanner_NewPlanE_RejectedDisabledFields(t *testing.T) {
+	t.Parallel()
+
+	providers := []FieldProvider{
+		&conditionalFieldProviderMock{
+			fieldProviderMock: fieldProviderMock{name: "disabled", provides: []Field{newNoopField("a")}},
+			enabled:           func(Request) bool { return false },
+		},
+	}
+
+	planner, err := NewQueryPlannerWithOptions(&indexProviderMock{}, providers, WithDisabledFieldPolicy(RejectDisabledFields))
+	require.NoError(t, err)
+
+	_, err = planner.NewPlanE(&requestMock{[]string{"a"}})
+	assert.EqualError(t, err, "queryplanner.NewPlanE: plan.disableField: field is only provided by disabled providers [field=a]")
+}
+
+func Test_levenshteinDistance(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{a: "", b: "", expected: 0},
+		{a: "name", b: "", expected: 4},
+		{a: "name", b: "name", expected: 0},
+		{a: "nmae", b: "name", expected: 2},
+		{a: "kitten", b: "sitting", expected: 3},
+		{a: "hadcovid", b: "had_covid", expected: 1},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, levenshteinDistance(test.a, test.b), "%s -> %s", test.a, test.b)
+	}
+}
+
+func TestNewQueryPlanner_InvalidGraph(t *testing.T) {
+	t.Parallel()
+
+	summary := newNoopField("summary")
+	summary.OptionalDependsOn = []FieldName{"missing", "_missing"}
+	fallback := newNoopField("name")
+	fallback.DependsOn = []FieldName{"unknown"}
+	providers := []FieldProvider{
+		&fieldProviderMock{name: "gov", dependsOn: []FieldName{"cpf", "_date"}, provides: []Field{newNoopField("name")}},
+		&prioritizedFieldProviderMock{
+			fieldProviderMock: fieldProviderMock{name: "replica", provides: []Field{fallback}},
+			priority:          1,
+		},
+		&fieldProviderMock{name: "summarizer", dependsOn: []FieldName{"name"}, provides: []Field{summary}},
+		&fieldProviderMock{name: "covid", dependsOn: []FieldName{"_cpf", "_vaccine"}, provides: []Field{newNoopField("had_covid")}},
+		&fieldProviderMock{name: "report", dependsOn: []FieldName{"had_covid", "name"}, provides: []Field{newNoopField("report")}},
+	}
+	indexProvider := &indexProviderMock{
+		provides: []Index{newNoopIndex("cpf"), newNoopIndex("date")},
+	}
+
+	_, err := NewQueryPlanner(indexProvider, providers...)
+
+	assert.EqualError(t, err, "queryplanner.NewQueryPlanner: checkDependencies: invalid dependency graph: "+
+		"field name of replica depends on unknown field unknown; "+
+		"field had_covid of covid depends on _vaccine, which the index does not provide; "+
+		"provider replica is unreachable; provider covid is unreachable; provider report is unreachable")
+
+	var invalidGraphErr *ErrInvalidGraph
+	require.True(t, stderrors.As(err, &invalidGraphErr))
+	assert.Equal(t, &ErrInvalidGraph{
+		DanglingDependencies: []InvalidDependency{
+			{Provider: "replica", Field: "name", Dependency: "unknown"},
+		},
+		UnsupportedIndexDependencies: []InvalidDependency{
+			{Provider: "covid", Field: "had_covid", Dependency: "_vaccine"},
+		},
+		UnreachableProviders: []string{"replica", "covid", "report"},
+	}, invalidGraphErr)
+}
+
+func TestNewQueryPlanner_EmptyDependency(t *testing.T) {
+	t.Parallel()
+
+	field := newNoopField("name")
+	field.DependsOn = []FieldName{""}
+	providers := []FieldProvider{
+		&fieldProviderMock{name: "gov", dependsOn: []FieldName{"cpf"}, provides: []Field{field}},
+	}
+	indexProvider := &indexProviderMock{provides: []Index{newNoopIndex("cpf")}}
+
+	_, err := NewQueryPlanner(indexProvider, providers...)
+
+	var invalidGraphErr *ErrInvalidGraph
+	require.True(t, stderrors.As(err, &invalidGraphErr), err)
+	assert.Equal(t, []InvalidDependency{{Provider: "gov", Field: "name", Dependency: ""}}, invalidGraphErr.DanglingDependencies)
+}
@@ -0,0 +1,66 @@
+package queryplanner
+
+import "strings"
+
+// isWildcard tells if the requested @field is a wildcard. See FieldName.
+func isWildcard(field string) bool {
+	return field == allFieldsWildcard || strings.HasSuffix(field, fieldPathSeparator+allFieldsWildcard)
+}
+
+// expandRequestedFields replaces the wildcards in @requestedFields by the
+// registered fields they match. Fields whose providers are all disabled for
+// the request are not matched. Duplicated fields are removed.
+//
+// The fields nested under a matched field with a child planner are requested
+// with a wildcard, e.g. Dependents.*, which is expanded by the child plan.
+func (q *queryPlanner) expandRequestedFields(p *plan, requestedFields []string) []string {
+	var registeredFields []FieldName
+	expanded := make([]string, 0, len(requestedFields))
+	added := newFieldNameSet(len(requestedFields))
+	add := func(field FieldName) {
+		if !added.Exists(field) {
+			added.Add(field)
+			expanded = append(expanded, string(field))
+		}
+	}
+
+	for _, requestedField := range requestedFields {
+		if !isWildcard(requestedField) {
+			add(FieldName(requestedField))
+			continue
+		}
+		if registeredFields == nil {
+			registeredFields = q.getRegisteredFieldNames()
+		}
+		for _, field := range q.getWildcardMatches(requestedField, registeredFields) {
+			_, isProvided := q.fieldToProviderMap.GetByName(field)
+			if isProvided && len(p.getEnabledAlternatives(field, q.fieldToProviderMap)) == 0 {
+				continue
+			}
+			add(field)
+			if q.fieldToProviderMap.HasChildren(field) {
+				add(getNestedFieldName(field, allFieldsWildcard))
+			}
+		}
+	}
+	return expanded
+}
+
+// getWildcardMatches returns the @registeredFields matched by @wildcard:
+// all of them for "*" and, for "Address.*", the fields nested under Address
+// and Address itself if it is a subtree.
+func (q *queryPlanner) getWildcardMatches(wildcard string, registeredFields []FieldName) []FieldName {
+	if wildcard == allFieldsWildcard {
+		return registeredFields
+	}
+
+	prefix := strings.TrimSuffix(wildcard, allFieldsWildcard)
+	parent := FieldName(strings.TrimSuffix(prefix, fieldPathSeparator))
+	matches := make([]FieldName, 0)
+	for _, field := range registeredFields {
+		if strings.HasPrefix(string(field), prefix) || (field == parent && q.fieldToProviderMap.IsSubtree(parent)) {
+			matches = append(matches, field)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,204 @@
+package queryplanner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryPlanner_Wildcards(t *testing.T) {
+	t.Parallel()
+
+	providers := []FieldProvider{
+		&fieldProviderMock{
+			name:      "address-provider",
+			dependsOn: []FieldName{"cpf"},
+			provides: []Field{{
+				Name:    "address",
+				Subtree: true,
+				FillValue: func(int, ExecutionContext) (interface{}, error) {
+					return MapDocument{"city": "Rio", "zip": "20000"}, nil
+				},
+			}},
+		},
+		&fieldProviderMock{
+			name:      "geo-provider",
+			dependsOn: []FieldName{"address.city"},
+			provides: []Field{{
+				Name: "address.geo.lat",
+				FillValue: func(index int, ec ExecutionContext) (interface{}, error) {
+					city, _ := mapDocumentAdapter{}.get("address.city", ec.Payload.Documents[index])
+					if city != "Rio" {
+						return nil, nil
+					}
+					return -22.9, nil
+				},
+			}},
+		},
+		&conditionalFieldProviderMock{
+			fieldProviderMock: fieldProviderMock{name: "disabled", provides: []Field{{Name: "name", FillValue: func(int, ExecutionContext) (interface{}, error) { return "Maria", nil }}}},
+			enabled:           func(Request) bool { return false },
+		},
+	}
+	indexProvider := &indexProviderMock{
+		provides: []Index{{Name: "cpf"}, {Name: "company.name"}},
+		execute: func(*indexProviderMock, context.Context, Request, []string) (*Payload, error) {
+			return &Payload{Documents: []Document{MapDocument{"cpf": "1", "company": MapDocument{"name": "Arquivei"}}}}, nil
+		},
+	}
+
+	planner, err := NewQueryPlannerWithOptions(indexProvider, providers, WithMapDocuments())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name              string
+		request           []string
+		expectedRequested []string
+		expectedUnknown   []UnknownField
+	}{
+		{
+			name:              "all fields",
+			request:           []string{"*"},
+			expectedRequested: []string{"address", "address.geo.lat", "company.name", "cpf"},
+		},
+		{
+			name:              "subtree",
+			request:           []string{"address.*", "address.geo.lat"},
+			expectedRequested: []string{"address", "address.geo.lat"},
+		},
+		{
+			name:              "nested fields",
+			request:           []string{"address.geo.*", "company.*"},
+			expectedRequested: []string{"address.geo.lat", "company.name"},
+		},
+		{
+			name:              "unknown fields",
+			request:           []string{"foo.*", "cpf.*", "cpf.number", "address.city"},
+			expectedRequested: []string{"cpf.number", "address.city"},
+			expectedUnknown:   []UnknownField{{Name: "foo.*"}, {Name: "cpf.*"}, {Name: "cpf.number"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := planner.NewPlan(&requestMock{test.request}).(plan)
+			assert.Equal(t, test.expectedRequested, p.requestedFields)
+
+			_, err := planner.NewPlanE(&requestMock{test.request})
+			if test.expectedUnknown == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var unknownFieldsErr *ErrUnknownFields
+			require.ErrorAs(t, err, &unknownFieldsErr)
+			assert.Equal(t, test.expectedUnknown, unknownFieldsErr.Fields)
+		})
+	}
+
+	projectionTests := []struct {
+		name              string
+		request           []string
+		expectedDocuments []map[string]interface{}
+	}{
+		{
+			name:    "all fields",
+			request: []string{"*"},
+			expectedDocuments: []map[string]interface{}{{
+				"address":         MapDocument{"city": "Rio", "zip": "20000", "geo": MapDocument{"lat": -22.9}},
+				"address.geo.lat": -22.9,
+				"company.name":    "Arquivei",
+				"cpf":             "1",
+			}},
+		},
+		{
+			name:    "nested fields",
+			request: []string{"address.geo.*", "company.*"},
+			expectedDocuments: []map[string]interface{}{{
+				"address.geo.lat": -22.9,
+				"company.name":    "Arquivei",
+			}},
+		},
+	}
+	for _, test := range projectionTests {
+		t.Run("project "+test.name, func(t *testing.T) {
+			t.Parallel()
+
+			projection, err := planner.NewPlan(&requestMock{test.request}).Project(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedDocuments, projection.Documents)
+		})
+	}
+}
+
+func TestPlanExecution_NestedFields(t *testing.T) {
+	t.Parallel()
+
+	providers := []FieldProvider{
+		&fieldProviderMock{
+			name:      "address-provider",
+			dependsOn: []FieldName{"cpf"},
+			provides: []Field{{
+				Name:    "address",
+				Subtree: true,
+				FillValue: func(int, ExecutionContext) (interface{}, error) {
+					return MapDocument{"city": "Rio", "zip": "20000"}, nil
+				},
+			}},
+		},
+		&fieldProviderMock{
+			name:      "geo-provider",
+			dependsOn: []FieldName{"address.city"},
+			provides: []Field{{
+				Name: "address.geo.lat",
+				FillValue: func(index int, ec ExecutionContext) (interface{}, error) {
+					city, _ := mapDocumentAdapter{}.get("address.city", ec.Payload.Documents[index])
+					if city != "Rio" {
+						return nil, nil
+					}
+					return -22.9, nil
+				},
+			}},
+		},
+	}
+	indexProvider := &indexProviderMock{
+		provides: []Index{{Name: "cpf"}},
+		execute: func(*indexProviderMock, context.Context, Request, []string) (*Payload, error) {
+			return &Payload{Documents: []Document{MapDocument{"cpf": "1"}}}, nil
+		},
+	}
+	planner, err := NewQueryPlannerWithOptions(indexProvider, providers, WithMapDocuments())
+	require.NoError(t, err)
+
+	request := &requestMock{[]string{"address.geo.lat"}}
+	explanation := planner.NewPlan(request).Explain()
+	assert.Equal(t, []string{"address-provider", "geo-provider"}, []string{explanation.Providers[0].Name, explanation.Providers[1].Name})
+
+	payload, err := planner.NewPlan(request).Execute(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Document{
+		MapDocument{"address": MapDocument{"city": "Rio", "zip": "20000", "geo": MapDocument{"lat": -22.9}}},
+	}, payload.Documents)
+
+	projection, err := planner.NewPlan(&requestMock{[]string{"address.city", "address.geo.lat"}}).Project(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"address.city": "Rio", "address.geo.lat": -22.9}}, projection.Documents)
+}
+
+func TestQueryPlanner_NestedDependencies(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewQueryPlannerWithOptions(
+		&indexProviderMock{provides: []Index{{Name: "cpf"}}},
+		[]FieldProvider{
+			&fieldProviderMock{name: "address-provider", provides: []Field{{Name: "address", Subtree: true, FillValue: func(int, ExecutionContext) (interface{}, error) { return nil, nil }}}},
+			&fieldProviderMock{name: "a-provider", dependsOn: []FieldName{"address.city", "cpf.number"}, provides: []Field{{Name: "a", FillValue: func(int, ExecutionContext) (interface{}, error) { return nil, nil }}}},
+		},
+		WithMapDocuments(),
+	)
+	var invalidGraphErr *ErrInvalidGraph
+	require.ErrorAs(t, err, &invalidGraphErr)
+	assert.Equal(t, []InvalidDependency{{Provider: "a-provider", Field: "a", Dependency: "cpf.number"}}, invalidGraphErr.DanglingDependencies)
+}